@@ -76,6 +76,7 @@ def docs():
         <li><b>GET</b> <a href="{base_url}/">/</a> — Главная страница</li>
         <li><b>GET</b> <a href="{base_url}/animals">/animals</a> — Список животных</li>
         <li><b>POST</b> <code>/api/animals</code> — Добавить животное</li>
+        <li><b>GET</b> <code>/api/animals/&lt;id&gt;</code> — Животное по id</li>
         <li><b>GET</b> <a href="{base_url}/slow">/slow</a> — Медленный эндпоинт (для алертов)</li>
         <li><b>GET</b> <a href="{base_url}/metrics">/metrics</a> — Метрики Prometheus</li>
         <li><b>UI</b> <a href="{base_url}/apidocs">Swagger UI</a> — Интерактивная документация</li>
@@ -196,6 +197,46 @@ def add_animal():
         if 'conn' in locals():
             conn.close()
 
+@app.route('/api/animals/<int:animal_id>', methods=['GET'])
+def get_animal(animal_id):
+    """Получить животное по id
+    ---
+    tags:
+      - Animals
+    parameters:
+      - in: path
+        name: animal_id
+        type: integer
+        required: true
+    responses:
+      200:
+        description: Животное
+      404:
+        description: Животное не найдено
+    """
+    start_time = time.time()
+    try:
+        conn = get_db()
+        cur = conn.cursor()
+        cur.execute("SELECT * FROM animals WHERE id = %s;", (animal_id,))
+        a = cur.fetchone()
+        if a is None:
+            return jsonify({"error": "animal not found"}), 404
+        return jsonify({
+            'id': a[0],
+            'name': a[1],
+            'type': a[2],
+            'age': a[3],
+            'arrival_date': a[4].isoformat() if a[4] else None,
+            'health': a[5]
+        })
+    except Exception as e:
+        return jsonify({"error": str(e)}), 500
+    finally:
+        REQUEST_LATENCY.labels('/api/animals/<id>').observe(time.time() - start_time)
+        if 'conn' in locals():
+            conn.close()
+
 @app.route('/slow')
 def slow_endpoint():
     """Медленный эндпоинт для теста алертов
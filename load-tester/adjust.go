@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const (
+	changeRPS     = "rps"
+	changeUsers   = "users"
+	changeProfile = "profile"
+	changeMix     = "mix"
+)
+
+// RunPatch changes a running test through PATCH /run. Fields left out keep
+// their current value, down to the single keys of profile_params.
+type RunPatch struct {
+	RPS           *int            `json:"rps,omitempty"`
+	Users         *int            `json:"users,omitempty"`
+	Profile       *string         `json:"profile,omitempty"`
+	ProfileParams json.RawMessage `json:"profile_params,omitempty"`
+	Mix           []MixEntry      `json:"mix,omitempty"`
+}
+
+// TimelineEvent is a change made to a run while it was going, at Elapsed
+// seconds into it.
+type TimelineEvent struct {
+	Elapsed float64 `json:"t"`
+	Type    string  `json:"type"`
+	From    string  `json:"from"`
+	To      string  `json:"to"`
+}
+
+var errNotRunning = errors.New("no run in progress")
+
+type RunChangedEvent struct {
+	RunID string `json:"run_id"`
+	TimelineEvent
+}
+
+func knownProfile(name string) bool {
+	for _, p := range profiles {
+		if p.Type == name {
+			return true
+		}
+	}
+	return false
+}
+
+// adjust applies patch to the running test. A changed profile starts over
+// from its beginning, as if the run had been started with it. testerMutex
+// must be held.
+func (lt *LoadTester) adjust(patch RunPatch) ([]TimelineEvent, error) {
+	lt.mutex.RLock()
+	running := lt.state.Running
+	cfg := lt.config
+	rps, users := lt.state.RPS, lt.state.MaxUsers
+	profile, params := lt.state.Profile, lt.state.ProfileParams
+	lt.mutex.RUnlock()
+
+	if !running {
+		return nil, errNotRunning
+	}
+	if cfg.Replay != nil && cfg.Replay.Mode != replayModeFixedRPS {
+		return nil, fmt.Errorf("a replay in %s mode cannot be changed while running", cfg.Replay.Mode)
+	}
+	if cfg.Replay != nil && patch.Mix != nil {
+		return nil, fmt.Errorf("the endpoint mix of a replay cannot be changed")
+	}
+
+	newProfile, newParams := profile, params
+	if patch.Profile != nil {
+		newProfile = *patch.Profile
+		if !knownProfile(newProfile) {
+			return nil, fmt.Errorf("unknown profile %q", newProfile)
+		}
+	}
+	if patch.ProfileParams != nil {
+		var err error
+		if newParams, err = mergeProfileParams(params, patch.ProfileParams); err != nil {
+			return nil, err
+		}
+	}
+	profileChanged := newProfile != profile || !reflect.DeepEqual(newParams, params)
+
+	newRPS, newUsers := rps, users
+	if cfg.Users != nil {
+		if patch.RPS != nil {
+			return nil, fmt.Errorf("a virtual users run is changed with users, not rps")
+		}
+		if patch.Users != nil {
+			newUsers = *patch.Users
+		}
+		if newUsers <= 0 || newUsers > maxUsers {
+			return nil, fmt.Errorf("users count must be between 1 and %d", maxUsers)
+		}
+		if err := newParams.validate(newProfile, newUsers); err != nil {
+			return nil, err
+		}
+	} else {
+		if patch.Users != nil {
+			return nil, fmt.Errorf("an open-model run is changed with rps, not users")
+		}
+		if patch.RPS != nil {
+			newRPS = *patch.RPS
+		} else if newProfile == "custom" && profileChanged {
+			newRPS = newParams.maxStageRPS()
+		}
+		if newRPS <= 0 || newRPS > maxRPS {
+			return nil, fmt.Errorf("RPS must be between 1 and %d", maxRPS)
+		}
+		if err := newParams.validate(newProfile, newRPS); err != nil {
+			return nil, err
+		}
+	}
+
+	var picker *endpointPicker
+	if patch.Mix != nil {
+		var err error
+		if picker, err = newEndpointPicker(patch.Mix); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	var changes []TimelineEvent
+
+	lt.mutex.Lock()
+	elapsed := now.Sub(lt.state.StartTime).Seconds()
+	change := func(typ, from, to string) {
+		e := TimelineEvent{Elapsed: elapsed, Type: typ, From: from, To: to}
+		changes = append(changes, e)
+		lt.state.Events = append(lt.state.Events, e)
+	}
+
+	if newRPS != rps {
+		lt.state.RPS = newRPS
+		change(changeRPS, strconv.Itoa(rps), strconv.Itoa(newRPS))
+	}
+	if newUsers != users {
+		lt.state.MaxUsers = newUsers
+		change(changeUsers, strconv.Itoa(users), strconv.Itoa(newUsers))
+	}
+	if profileChanged {
+		lt.state.Profile = newProfile
+		lt.state.ProfileParams = newParams
+		lt.profileStart = now
+		change(changeProfile, profile, newProfile)
+	}
+	if picker != nil {
+		from := describeMix(lt.state.Mix)
+		lt.source = picker
+		lt.mergeCountersLocked(picker.counters())
+		lt.state.Mix = patch.Mix
+		lt.state.Endpoint = patch.Mix[0].Endpoint
+		change(changeMix, from, describeMix(patch.Mix))
+	}
+	runID := lt.state.RunID
+	lt.mutex.Unlock()
+
+	if len(changes) == 0 {
+		return changes, nil
+	}
+
+	select {
+	case lt.adjusted <- struct{}{}:
+	default:
+	}
+	for _, e := range changes {
+		log.Printf("🔧 Run %s changed at %.0fs: %s %s → %s", runID, e.Elapsed, e.Type, e.From, e.To)
+		events.publish(eventRunChanged, RunChangedEvent{RunID: runID, TimelineEvent: e})
+	}
+	events.publish(eventSnapshot, lt.snapshot())
+	return changes, nil
+}
+
+// mergeProfileParams returns params with the keys given in patch replaced.
+// The result is decoded afresh, so it shares no stages or pointers with
+// params.
+func mergeProfileParams(params ProfileParams, patch json.RawMessage) (ProfileParams, error) {
+	var merged ProfileParams
+	current, err := json.Marshal(params)
+	if err != nil {
+		return merged, err
+	}
+	if err := json.Unmarshal(current, &merged); err != nil {
+		return merged, err
+	}
+	if err := json.Unmarshal(patch, &merged); err != nil {
+		return merged, fmt.Errorf("invalid profile_params: %w", err)
+	}
+	merged.applyDefaults()
+	return merged, nil
+}
+
+// mergeCountersLocked switches the per-endpoint counters to a new mix:
+// endpoints that stay keep their counts, new ones start from zero and the
+// ones that left keep what they got with a share of zero. lt.mutex must be
+// held.
+func (lt *LoadTester) mergeCountersLocked(next map[string]*endpointCounters) {
+	for _, c := range lt.endpointStats {
+		c.share = 0
+	}
+	for key, c := range next {
+		if old, ok := lt.endpointStats[key]; ok {
+			old.share = c.share
+			continue
+		}
+		lt.endpointStats[key] = c
+	}
+}
+
+// profileTarget returns what the run's profile asks for now: requests per
+// second for open-model runs, virtual users for closed-model ones.
+func (lt *LoadTester) profileTarget() int {
+	lt.mutex.RLock()
+	profile, params, since := lt.state.Profile, lt.state.ProfileParams, lt.profileStart
+	peak := lt.state.RPS
+	if lt.config.Users != nil {
+		peak = lt.state.MaxUsers
+	}
+	lt.mutex.RUnlock()
+
+	return profileRPS(profile, peak, params, time.Since(since).Seconds())
+}
+
+func runPatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PATCH" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var patch RunPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	testerMutex.Lock()
+	defer testerMutex.Unlock()
+
+	changes, err := loadTester.adjust(patch)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errNotRunning) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
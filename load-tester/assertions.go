@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// Kinds of failed checks, counted separately from transport errors in
+// AppState.AssertionFailures.
+const (
+	assertStatus      = "status"
+	assertContains    = "contains"
+	assertNotContains = "not_contains"
+	assertJSONPath    = "jsonpath"
+	assertSchema      = "schema"
+	assertBodySize    = "body_size"
+	assertDuration    = "duration"
+	assertExtraction  = "extraction"
+)
+
+// Assertions check a response beyond its status code. String values are
+// templates, so a scenario step can check for values extracted by earlier
+// steps, e.g. {{.id}}.
+type Assertions struct {
+	Status        []int               `json:"status,omitempty"`
+	Contains      []string            `json:"contains,omitempty"`
+	NotContains   []string            `json:"not_contains,omitempty"`
+	JSONPath      []JSONPathAssertion `json:"jsonpath,omitempty"`
+	JSONSchema    json.RawMessage     `json:"json_schema,omitempty"`
+	MaxBodyBytes  int64               `json:"max_body_bytes,omitempty"`
+	MaxDurationMs float64             `json:"max_duration_ms,omitempty"`
+
+	contains    []*template.Template
+	notContains []*template.Template
+	schema      *jsonSchema
+}
+
+// JSONPathAssertion passes when Path matches something and, if Equals is
+// set, one of the matched values equals it. With Exists set to false it
+// passes only when Path matches nothing.
+type JSONPathAssertion struct {
+	Path   string          `json:"path"`
+	Equals json.RawMessage `json:"equals,omitempty"`
+	Exists *bool           `json:"exists,omitempty"`
+
+	path   jsonPath
+	equals *template.Template
+}
+
+// assertionError is a response that arrived but failed one of the checks of
+// its endpoint.
+type assertionError struct {
+	kind string
+	msg  string
+}
+
+func (e *assertionError) Error() string {
+	return e.kind + ": " + e.msg
+}
+
+func failAssertion(kind, format string, args ...interface{}) *assertionError {
+	return &assertionError{kind: kind, msg: fmt.Sprintf(format, args...)}
+}
+
+func (a *Assertions) compile() error {
+	var err error
+	if a.contains, err = parseTemplates("contains", a.Contains); err != nil {
+		return err
+	}
+	if a.notContains, err = parseTemplates("not_contains", a.NotContains); err != nil {
+		return err
+	}
+
+	for i := range a.JSONPath {
+		check := &a.JSONPath[i]
+		path, err := compileJSONPath(check.Path)
+		if err != nil {
+			return err
+		}
+		check.path = path
+
+		if len(check.Equals) > 0 {
+			text := string(check.Equals)
+			var s string
+			if json.Unmarshal(check.Equals, &s) == nil {
+				text = s
+			}
+			if check.equals, err = parseTemplate("equals", text); err != nil {
+				return fmt.Errorf("jsonpath %s equals template: %w", check.Path, err)
+			}
+		}
+	}
+
+	if len(a.JSONSchema) > 0 {
+		if a.schema, err = compileJSONSchema(a.JSONSchema); err != nil {
+			return err
+		}
+	}
+	if a.MaxBodyBytes < 0 || a.MaxDurationMs < 0 {
+		return fmt.Errorf("max_body_bytes and max_duration_ms must not be negative")
+	}
+	return nil
+}
+
+func parseTemplates(name string, texts []string) ([]*template.Template, error) {
+	result := make([]*template.Template, len(texts))
+	for i, s := range texts {
+		t, err := parseTemplate(name, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s template: %w", name, err)
+		}
+		result[i] = t
+	}
+	return result, nil
+}
+
+// needsBody reports whether checking a response takes its body; otherwise
+// the body is not read at all.
+func (a *Assertions) needsBody() bool {
+	return a != nil && (a.checksContent() || a.MaxBodyBytes > 0)
+}
+
+// checksContent reports whether checking a response looks into its body,
+// rather than only at its size.
+func (a *Assertions) checksContent() bool {
+	return len(a.Contains) > 0 || len(a.NotContains) > 0 || len(a.JSONPath) > 0 || a.schema != nil
+}
+
+func (a *Assertions) allowsStatus(code int) bool {
+	for _, s := range a.Status {
+		if s == code {
+			return true
+		}
+	}
+	return false
+}
+
+// apply checks resp and updates res accordingly. With an explicit status
+// list an HTTP error status can count as success, and a status outside of it
+// fails the request even if it is below 400.
+func (a *Assertions) apply(resp *responseData, res *requestResult, data interface{}) {
+	if a == nil || resp == nil {
+		return
+	}
+	if len(a.Status) > 0 {
+		if !a.allowsStatus(resp.StatusCode) {
+			res.fail(failAssertion(assertStatus, "status %d, expected one of %v", resp.StatusCode, a.Status))
+			return
+		}
+		res.Err = nil
+	}
+	if res.Err != nil {
+		return
+	}
+
+	if a.MaxDurationMs > 0 && res.Duration > time.Duration(a.MaxDurationMs*float64(time.Millisecond)) {
+		res.fail(failAssertion(assertDuration, "took %.1fms, limit %gms",
+			float64(res.Duration)/float64(time.Millisecond), a.MaxDurationMs))
+		return
+	}
+	if a.MaxBodyBytes > 0 && resp.Size > a.MaxBodyBytes {
+		res.fail(failAssertion(assertBodySize, "body is %d bytes, limit %d", resp.Size, a.MaxBodyBytes))
+		return
+	}
+	if resp.Truncated && a.checksContent() {
+		res.truncated()
+		return
+	}
+	if err := a.checkBody(resp, data); err != nil {
+		res.fail(err)
+	}
+}
+
+func (a *Assertions) checkBody(resp *responseData, data interface{}) *assertionError {
+	for _, t := range a.contains {
+		want, err := renderTemplate(t, data)
+		if err != nil {
+			return failAssertion(assertContains, "%v", err)
+		}
+		if !bytes.Contains(resp.Body, []byte(want)) {
+			return failAssertion(assertContains, "body does not contain %q", want)
+		}
+	}
+	for _, t := range a.notContains {
+		unwanted, err := renderTemplate(t, data)
+		if err != nil {
+			return failAssertion(assertNotContains, "%v", err)
+		}
+		if bytes.Contains(resp.Body, []byte(unwanted)) {
+			return failAssertion(assertNotContains, "body contains %q", unwanted)
+		}
+	}
+
+	if len(a.JSONPath) == 0 && a.schema == nil {
+		return nil
+	}
+	doc, err := resp.json()
+	if err != nil {
+		kind := assertJSONPath
+		if len(a.JSONPath) == 0 {
+			kind = assertSchema
+		}
+		return failAssertion(kind, "body is not JSON: %v", err)
+	}
+
+	for _, check := range a.JSONPath {
+		matches := check.path.find(doc)
+
+		if check.Exists != nil && !*check.Exists {
+			if len(matches) > 0 {
+				return failAssertion(assertJSONPath, "%s exists", check.Path)
+			}
+			continue
+		}
+		if len(matches) == 0 {
+			return failAssertion(assertJSONPath, "%s not found", check.Path)
+		}
+		if check.equals == nil {
+			continue
+		}
+
+		want, err := renderTemplate(check.equals, data)
+		if err != nil {
+			return failAssertion(assertJSONPath, "%v", err)
+		}
+		found := false
+		for _, m := range matches {
+			if jsonString(m) == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return failAssertion(assertJSONPath, "%s has no value %s", check.Path, strconv.Quote(want))
+		}
+	}
+
+	if a.schema != nil {
+		if err := a.schema.validate(doc, "$"); err != nil {
+			return failAssertion(assertSchema, "%v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAssertionsApply(t *testing.T) {
+	body := `{"id": 42, "name": "Барсик", "tags": ["cat"]}`
+	no := false
+
+	tests := []struct {
+		name   string
+		assert Assertions
+		status int
+		want   string
+	}{
+		{"no checks", Assertions{}, 200, ""},
+		{"status listed", Assertions{Status: []int{200, 201}}, 201, ""},
+		{"status not listed", Assertions{Status: []int{201}}, 200, assertStatus},
+		{"error status allowed", Assertions{Status: []int{404}}, 404, ""},
+		{"contains", Assertions{Contains: []string{"Барсик"}}, 200, ""},
+		{"contains template", Assertions{Contains: []string{`"id": {{.id}}`}}, 200, ""},
+		{"does not contain", Assertions{Contains: []string{"Мурка"}}, 200, assertContains},
+		{"not contains", Assertions{NotContains: []string{"error"}}, 200, ""},
+		{"not contains hit", Assertions{NotContains: []string{"cat"}}, 200, assertNotContains},
+		{"jsonpath exists", Assertions{JSONPath: []JSONPathAssertion{{Path: "$.tags[0]"}}}, 200, ""},
+		{"jsonpath missing", Assertions{JSONPath: []JSONPathAssertion{{Path: "$.owner"}}}, 200, assertJSONPath},
+		{"jsonpath absent", Assertions{JSONPath: []JSONPathAssertion{{Path: "$.owner", Exists: &no}}}, 200, ""},
+		{"jsonpath present", Assertions{JSONPath: []JSONPathAssertion{{Path: "$.id", Exists: &no}}}, 200, assertJSONPath},
+		{"jsonpath equals number", Assertions{JSONPath: []JSONPathAssertion{{Path: "$.id", Equals: json.RawMessage(`42`)}}}, 200, ""},
+		{"jsonpath equals template", Assertions{JSONPath: []JSONPathAssertion{{Path: "$.id", Equals: json.RawMessage(`"{{.id}}"`)}}}, 200, ""},
+		{"jsonpath differs", Assertions{JSONPath: []JSONPathAssertion{{Path: "$.name", Equals: json.RawMessage(`"Мурка"`)}}}, 200, assertJSONPath},
+		{"schema", Assertions{JSONSchema: json.RawMessage(`{"required": ["id"]}`)}, 200, ""},
+		{"schema violated", Assertions{JSONSchema: json.RawMessage(`{"required": ["owner"]}`)}, 200, assertSchema},
+		{"body size", Assertions{MaxBodyBytes: 10}, 200, assertBodySize},
+		{"duration", Assertions{MaxDurationMs: 5}, 200, assertDuration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.assert.compile(); err != nil {
+				t.Fatal(err)
+			}
+			resp := &responseData{StatusCode: tt.status, Body: []byte(body), Size: int64(len(body))}
+			res := requestResult{StatusCode: tt.status, Duration: 10 * time.Millisecond}
+			if tt.status >= 400 {
+				res.Err = fmt.Errorf("HTTP %d", tt.status)
+			}
+
+			tt.assert.apply(resp, &res, map[string]string{"id": "42"})
+			if res.Assertion != tt.want {
+				t.Errorf("assertion %q, want %q (error %v)", res.Assertion, tt.want, res.Err)
+			}
+			if tt.want == "" && res.Err != nil {
+				t.Errorf("passing check left error %v", res.Err)
+			}
+		})
+	}
+}
+
+func TestAssertionsNotJSON(t *testing.T) {
+	a := Assertions{JSONSchema: json.RawMessage(`{"type": "object"}`)}
+	if err := a.compile(); err != nil {
+		t.Fatal(err)
+	}
+	res := requestResult{StatusCode: 200}
+	a.apply(&responseData{StatusCode: 200, Body: []byte("<html>")}, &res, nil)
+	if res.Assertion != assertSchema {
+		t.Errorf("assertion %q", res.Assertion)
+	}
+}
+
+func TestAssertionsTruncatedBody(t *testing.T) {
+	resp := &responseData{StatusCode: 200, Body: []byte(`[{"id": 1}, {"id"`), Size: 2 * maxResponseBody, Truncated: true}
+
+	content := Assertions{JSONPath: []JSONPathAssertion{{Path: "$[*].id"}}}
+	if err := content.compile(); err != nil {
+		t.Fatal(err)
+	}
+	res := requestResult{StatusCode: 200}
+	content.apply(resp, &res, nil)
+	if res.ErrorClass != errorClassBodyTruncated || res.Assertion != "" {
+		t.Errorf("class %q, assertion %q", res.ErrorClass, res.Assertion)
+	}
+
+	// Checks that do not look into the body still pass.
+	status := Assertions{Status: []int{200}}
+	if err := status.compile(); err != nil {
+		t.Fatal(err)
+	}
+	res = requestResult{StatusCode: 200}
+	status.apply(resp, &res, nil)
+	if res.Err != nil {
+		t.Errorf("status check failed: %v", res.Err)
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	exitOK        = 0
+	exitFailed    = 1
+	exitBadConfig = 2
+)
+
+// runCLI runs a single load test without the web UI and returns the process
+// exit code: exitFailed when a threshold failed or the run regressed against
+// its baseline.
+func runCLI(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: load-tester run [flags]")
+		fs.PrintDefaults()
+	}
+
+	var cfg RunConfig
+	var stages, replayFile, reportPath, baselineID, think, scenario, spec string
+	var users, maxRedirects int
+	var duration, requestTimeout, dialTimeout, headerTimeout time.Duration
+	var replayCfg ReplayConfig
+
+	fs.StringVar(&cfg.Target, "target", getEnv("TARGET_URL", "http://localhost:8000"), "base URL of the API under test")
+	fs.StringVar(&cfg.Endpoint, "endpoint", "/animals", "endpoint path to load")
+	method := fs.String("method", "", "HTTP method of the endpoint (default: any registered)")
+	fs.StringVar(&spec, "import-spec", "", "register the operations of the target's Swagger spec first, e.g. "+defaultSpecPath)
+	fs.StringVar(&scenario, "scenario", "", "run a registered scenario instead of an endpoint, e.g. new_animal")
+	fs.StringVar(&cfg.Profile, "profile", "constant", "load profile: constant, ramp_up, spike, wave, step, stress, custom")
+	fs.IntVar(&cfg.RPS, "rps", 10, "maximum requests per second")
+	fs.IntVar(&users, "users", 0, "run N virtual users instead of a fixed RPS; profiles ramp the user count")
+	fs.StringVar(&think, "think", "1s", "virtual user think time: 2s, exponential:1s or uniform:500ms-2s")
+	fs.DurationVar(&duration, "duration", 0, "stop after this long, e.g. 2m (0 = until interrupted)")
+	fs.Int64Var(&cfg.MaxRequests, "max-requests", 0, "stop after this many requests (0 = no limit)")
+	fs.IntVar(&cfg.MaxInFlight, "max-in-flight", defaultMaxInFlight, "drop requests while this many are waiting for a response")
+	fs.Float64Var(&cfg.ProfileParams.RampDuration, "ramp-duration", 0, "ramp_up: seconds to reach max RPS")
+	fs.StringVar(&cfg.ProfileParams.Arrival, "arrival", arrivalUniform, "inter-arrival distribution: uniform, poisson, bursty")
+	fs.Float64Var(&cfg.ProfileParams.BurstOnSec, "burst-on", 0, "bursty: seconds of load in every on/off cycle")
+	fs.Func("burst-off", fmt.Sprintf("bursty: seconds of silence in every on/off cycle (default %g)", float64(defaultBurstOffSec)), func(value string) error {
+		v, err := strconv.ParseFloat(value, 64)
+		cfg.ProfileParams.BurstOffSec = &v
+		return err
+	})
+	fs.StringVar(&stages, "stages", "", "custom: comma-separated stages as duration_sec:rps[:linear|instant]")
+	fs.StringVar(&replayFile, "replay", "", "replay file from REPLAY_DIR instead of an endpoint")
+	fs.StringVar(&replayCfg.Mode, "replay-mode", replayModeOriginal, "replay mode: original, scaled, fixed_rps")
+	fs.Float64Var(&replayCfg.Speed, "speed", 1, "replay speed for scaled mode")
+	fs.BoolVar(&replayCfg.Loop, "loop", false, "loop the replay file")
+	fs.BoolVar(&cfg.Client.DisableKeepAlive, "no-keep-alive", false, "open a new connection for every request")
+	fs.IntVar(&cfg.Client.MaxIdleConnsPerHost, "max-idle-conns", defaultMaxIdleConns, "idle connections kept open per host")
+	fs.IntVar(&cfg.Client.MaxConnsPerHost, "max-conns", 0, "open connections per host (0 = no limit)")
+	fs.DurationVar(&requestTimeout, "request-timeout", defaultRequestTimeoutMs*time.Millisecond, "timeout of a whole request")
+	fs.DurationVar(&dialTimeout, "dial-timeout", defaultDialTimeoutMs*time.Millisecond, "timeout of opening a connection")
+	fs.DurationVar(&headerTimeout, "header-timeout", 0, "timeout of waiting for response headers (0 = request timeout only)")
+	fs.StringVar(&cfg.Client.Protocol, "protocol", protocolHTTP1, "HTTP version: http1 or http2 (http2 needs an https target)")
+	fs.BoolVar(&cfg.Client.DisableCompression, "no-compression", false, "do not ask for gzip-compressed responses")
+	fs.IntVar(&maxRedirects, "max-redirects", defaultMaxRedirects, "redirects to follow (0 = report the redirect itself)")
+	fs.BoolVar(&cfg.Client.InsecureSkipTLS, "insecure", false, "skip TLS certificate verification")
+	fs.BoolVar(&cfg.Client.HashBodies, "hash-bodies", false, "hash response bodies to count distinct ones per endpoint")
+	fs.StringVar(&reportPath, "report", "", "write the final run record as JSON to this file")
+	fs.Func("threshold", `pass/fail condition, e.g. "p95 < 300ms abort 10s" (repeatable)`, func(expr string) error {
+		cfg.Thresholds = append(cfg.Thresholds, Threshold{Expr: expr})
+		return nil
+	})
+	fs.StringVar(&baselineID, "baseline", "", `run ID to compare against, or "pinned" for the workload's pinned baseline`)
+
+	if err := fs.Parse(args); err != nil {
+		return exitBadConfig
+	}
+
+	if spec != "" {
+		if _, err := importSpec(specURL(cfg.Target, spec)); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to import spec: %v\n", err)
+			return exitBadConfig
+		}
+	}
+
+	cfg.DurationSec = duration.Seconds()
+	cfg.Client.RequestTimeoutMs = float64(requestTimeout) / float64(time.Millisecond)
+	cfg.Client.DialTimeoutMs = float64(dialTimeout) / float64(time.Millisecond)
+	cfg.Client.ResponseHeaderTimeoutMs = float64(headerTimeout) / float64(time.Millisecond)
+	cfg.Client.MaxRedirects = &maxRedirects
+	if *method != "" {
+		cfg.Mix = []MixEntry{{Endpoint: cfg.Endpoint, Method: *method, Weight: 1}}
+	}
+	if scenario != "" {
+		cfg.Endpoint = scenario
+		cfg.Mix = []MixEntry{{Endpoint: scenario, Method: scenarioMethod, Weight: 1}}
+	}
+	if replayFile != "" {
+		replayCfg.File = replayFile
+		cfg.Replay = &replayCfg
+	}
+	if users > 0 {
+		thinkTime, err := parseThinkTime(think)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --think: %v\n", err)
+			return exitBadConfig
+		}
+		cfg.Users = &UsersConfig{Count: users, ThinkTime: thinkTime}
+	}
+	if stages != "" {
+		parsed, err := parseStages(stages)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --stages: %v\n", err)
+			return exitBadConfig
+		}
+		cfg.ProfileParams.Stages = parsed
+	}
+
+	plan, err := newRunPlan(&cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid run configuration: %v\n", err)
+		return exitBadConfig
+	}
+
+	loadTester = newLoadTester()
+	lt := loadTester
+
+	testerMutex.Lock()
+	lt.start(cfg, plan)
+	testerMutex.Unlock()
+	if cfg.Users != nil {
+		fmt.Printf("▶️  %s against %s, %s profile\n", plan.description, cfg.Target, cfg.Profile)
+	} else {
+		fmt.Printf("▶️  %s against %s, %s profile, %d RPS\n", plan.description, cfg.Target, cfg.Profile, cfg.RPS)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for done := false; !done; {
+		select {
+		case <-sigChan:
+			testerMutex.Lock()
+			if lt.state.Running {
+				lt.stop(stopReasonManual)
+			}
+			testerMutex.Unlock()
+		case <-ticker.C:
+			lt.mutex.RLock()
+			done = !lt.state.Running && lt.state.Summary != nil
+			lt.mutex.RUnlock()
+			if !done {
+				printProgress(lt)
+			}
+		}
+	}
+
+	// stop holds testerMutex until the run record is saved.
+	testerMutex.Lock()
+	record := lt.lastRecord
+	testerMutex.Unlock()
+
+	if baselineID != "" && baselineID != "pinned" {
+		base, err := runs.get(baselineID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load baseline run %s: %v\n", baselineID, err)
+			return exitBadConfig
+		}
+		bl, err := baselines.load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load thresholds: %v\n", err)
+			return exitBadConfig
+		}
+		record.Comparison = compareRuns(base, record, bl.Thresholds)
+		if err := runs.save(record); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save run %s: %v\n", record.ID, err)
+		}
+	}
+
+	printReport(record)
+
+	if reportPath != "" {
+		data, _ := json.MarshalIndent(record, "", "  ")
+		if err := os.WriteFile(reportPath, data, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write report: %v\n", err)
+			return exitFailed
+		}
+		fmt.Printf("📝 Report written to %s\n", reportPath)
+	}
+
+	if baselineID == "pinned" && record.Comparison == nil {
+		fmt.Println("⚠️  No baseline pinned for this workload, nothing to compare against")
+	}
+	status := exitOK
+	if record.Summary.Failed {
+		fmt.Println("🚨 FAIL: thresholds not met")
+		status = exitFailed
+	}
+	if record.Comparison != nil && record.Comparison.Regression {
+		fmt.Println("🚨 FAIL: regression against baseline " + record.Comparison.BaseID)
+		status = exitFailed
+	}
+	return status
+}
+
+func parseStages(s string) ([]Stage, error) {
+	var stages []Stage
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("stage %q must be duration_sec:rps[:transition]", part)
+		}
+		duration, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("stage %q: %w", part, err)
+		}
+		rps, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("stage %q: %w", part, err)
+		}
+		stage := Stage{Duration: duration, RPS: rps}
+		if len(fields) == 3 {
+			stage.Transition = fields[2]
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+func printProgress(lt *LoadTester) {
+	lt.mutex.RLock()
+	elapsed := time.Since(lt.state.StartTime)
+	currentRPS := lt.state.CurrentRPS
+	if lt.config.Users != nil {
+		currentRPS = lt.state.AchievedRPS
+	}
+	users := lt.state.Users
+	total, errors := lt.state.TotalReqs, lt.state.ErrorReqs
+	var breached []string
+	for _, r := range lt.state.Thresholds {
+		if !r.Passed {
+			breached = append(breached, fmt.Sprintf("%s (%.2f for %ds)", r.Expr, r.Actual, r.BreachedSec))
+		}
+	}
+	lt.mutex.RUnlock()
+
+	errorRate := 0.0
+	if total > 0 {
+		errorRate = float64(errors) / float64(total) * 100
+	}
+	latency := lt.latency.Stats()
+
+	fmt.Printf("[%6s] rps %4d  total %7d  errors %5d (%5.2f%%)  p50 %7.1fms  p95 %7.1fms  in-flight %d\n",
+		elapsed.Truncate(time.Second), currentRPS, total, errors, errorRate, latency.P50, latency.P95,
+		atomic.LoadInt64(&lt.inFlight))
+	if users > 0 {
+		fmt.Printf("         👥 %d virtual users\n", users)
+	}
+	if len(breached) > 0 {
+		fmt.Printf("         ⚠️  breached: %s\n", strings.Join(breached, "; "))
+	}
+}
+
+func printReport(record *RunRecord) {
+	s := record.Summary
+
+	fmt.Println()
+	fmt.Printf("📋 Run %s finished (%s) after %.1fs\n", record.ID, s.StopReason, s.DurationSec)
+	fmt.Printf("   requests   %d total, %d ok, %d errors (%.2f%%)\n", s.TotalReqs, s.SuccessReqs, s.ErrorReqs, s.ErrorRate)
+	if s.TargetRPS == 0 {
+		fmt.Printf("   rps        %.1f achieved\n", s.AchievedRPS)
+	} else {
+		fmt.Printf("   rps        %.1f achieved of %.1f target\n", s.AchievedRPS, s.TargetRPS)
+	}
+	fmt.Printf("   latency    p50 %.1fms  p90 %.1fms  p95 %.1fms  p99 %.1fms  max %.1fms\n",
+		s.Latency.P50, s.Latency.P90, s.Latency.P95, s.Latency.P99, s.Latency.Max)
+	fmt.Printf("   corrected  p50 %.1fms  p90 %.1fms  p95 %.1fms  p99 %.1fms  max %.1fms\n",
+		s.Corrected.P50, s.Corrected.P90, s.Corrected.P95, s.Corrected.P99, s.Corrected.Max)
+	fmt.Printf("   pacing     %d sent of %d scheduled, %d dropped, send lag p99 %.2fms\n",
+		s.Pacing.Sent, s.Pacing.Scheduled, s.Pacing.Dropped, s.Pacing.SendLag.P99)
+	fmt.Printf("   conns      %d opened, %d reused (%.1f%% of requests), %d new\n",
+		s.Connections.Opened, s.Connections.Reused, s.Connections.ReusePct, s.Connections.New)
+	fmt.Printf("   traffic    %.2f MB/s received, %.2f MB/s sent, avg response %.0f B, avg request %.0f B (wire %d B in, %d B out)\n",
+		s.Traffic.ReceivedMBps, s.Traffic.SentMBps, s.Traffic.AvgResponseBytes, s.Traffic.AvgRequestBytes,
+		s.Traffic.WireBytesRecv, s.Traffic.WireBytesSent)
+
+	codes := make([]string, 0, len(s.StatusCodes)+len(s.ErrorClasses))
+	for code, n := range s.StatusCodes {
+		codes = append(codes, fmt.Sprintf("%s=%d", code, n))
+	}
+	for class, n := range s.ErrorClasses {
+		codes = append(codes, fmt.Sprintf("%s=%d", class, n))
+	}
+	sort.Strings(codes)
+	if len(codes) > 0 {
+		fmt.Printf("   responses  %s\n", strings.Join(codes, " "))
+	}
+	if len(s.Assertions) > 0 {
+		failed := make([]string, 0, len(s.Assertions))
+		for kind, n := range s.Assertions {
+			failed = append(failed, fmt.Sprintf("%s=%d", kind, n))
+		}
+		sort.Strings(failed)
+		fmt.Printf("   assertions %s failed\n", strings.Join(failed, " "))
+	}
+
+	fmt.Println("\n🔬 Phases:")
+	for _, p := range []struct {
+		name  string
+		stats LatencyStats
+	}{
+		{"conn wait", s.Phases.ConnWait}, {"dns", s.Phases.DNS}, {"connect", s.Phases.Connect}, {"tls", s.Phases.TLS},
+		{"ttfb", s.Phases.TTFB}, {"transfer", s.Phases.Transfer},
+	} {
+		if p.stats.Count == 0 {
+			continue
+		}
+		fmt.Printf("   %-9s %7d  p50 %7.2fms  p95 %7.2fms  p99 %7.2fms  max %7.2fms\n",
+			p.name, p.stats.Count, p.stats.P50, p.stats.P95, p.stats.P99, p.stats.Max)
+	}
+
+	// Scenarios move their payload in their steps.
+	var payload []EndpointStats
+	for _, e := range s.PerEndpoint {
+		if len(e.Steps) > 0 {
+			payload = append(payload, e.Steps...)
+		} else {
+			payload = append(payload, e)
+		}
+	}
+	if len(payload) > 0 {
+		fmt.Println("\n📦 Payload per endpoint:")
+	}
+	for _, e := range payload {
+		distinct := ""
+		if e.DistinctBodies > 0 {
+			distinct = fmt.Sprintf(", %d distinct bodies", e.DistinctBodies)
+		}
+		fmt.Printf("   %-7s %-24s avg response %8.0f B  avg request %6.0f B  %6.2f MB/s%s\n",
+			e.Method, e.Path, e.Traffic.AvgResponseBytes, e.Traffic.AvgRequestBytes, e.Traffic.ReceivedMBps, distinct)
+	}
+
+	for _, e := range s.PerEndpoint {
+		if len(e.Steps) == 0 {
+			continue
+		}
+		fmt.Printf("\n🧭 Scenario %s: %d iterations, %d failed, end-to-end p50 %.1fms  p95 %.1fms\n",
+			e.Name, e.TotalReqs, e.ErrorReqs, e.Latency.P50, e.Latency.P95)
+		for i, step := range e.Steps {
+			fmt.Printf("   %d. %-7s %-24s %6d req  %5d err  p50 %7.1fms  p95 %7.1fms\n",
+				i+1, step.Method, step.Path, step.TotalReqs, step.ErrorReqs, step.Latency.P50, step.Latency.P95)
+		}
+	}
+
+	if len(s.UsersCurve) > 0 {
+		fmt.Println("\n👥 Users vs throughput:")
+		for _, p := range s.UsersCurve {
+			fmt.Printf("   %5d users  %8.1f rps  p50 %7.1fms  p95 %7.1fms  (%ds)\n", p.Users, p.AchievedRPS, p.P50, p.P95, p.Seconds)
+		}
+	}
+
+	if len(s.Thresholds) > 0 {
+		fmt.Println("\n🎯 Thresholds:")
+		for _, r := range s.Thresholds {
+			mark := "✅"
+			if !r.Passed {
+				mark = "❌"
+			}
+			note := ""
+			if r.Aborted {
+				note = "  (aborted the run)"
+			}
+			fmt.Printf("   %s %-32s actual %.2f%s\n", mark, r.Expr, r.Actual, note)
+		}
+	}
+
+	if c := record.Comparison; c != nil {
+		fmt.Printf("\n⚖️  Against baseline %s:\n", c.BaseID)
+		if !c.SameWorkload {
+			fmt.Println("   different workload, compared but not judged")
+		}
+		for _, m := range c.Metrics {
+			mark := ""
+			if m.Regression {
+				mark = "  ❌"
+			}
+			fmt.Printf("   %-13s %10.2f → %10.2f  (%+.1f%%)%s\n", m.Name, m.Base, m.Current, m.DeltaPct, mark)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	protocolHTTP1 = "http1"
+	protocolHTTP2 = "http2"
+
+	defaultRequestTimeoutMs  = 5000
+	defaultDialTimeoutMs     = 5000
+	defaultTLSTimeoutMs      = 5000
+	defaultMaxIdleConns      = 100
+	defaultMaxRedirects      = 10
+	defaultKeepAliveProbeSec = 30
+)
+
+// ClientConfig tunes the HTTP client shared by all requests of a run. Zero
+// values take the defaults, except where noted.
+type ClientConfig struct {
+	// DisableKeepAlive opens a new connection for every request.
+	DisableKeepAlive    bool `json:"disable_keep_alive,omitempty"`
+	MaxIdleConnsPerHost int  `json:"max_idle_conns_per_host,omitempty"`
+	// MaxConnsPerHost caps open connections; requests beyond it wait for
+	// one to free up. 0 means no limit.
+	MaxConnsPerHost int `json:"max_conns_per_host,omitempty"`
+
+	RequestTimeoutMs float64 `json:"request_timeout_ms,omitempty"`
+	DialTimeoutMs    float64 `json:"dial_timeout_ms,omitempty"`
+	TLSTimeoutMs     float64 `json:"tls_handshake_timeout_ms,omitempty"`
+	// ResponseHeaderTimeoutMs limits the wait for response headers after
+	// the request is written. 0 means only the request timeout applies.
+	ResponseHeaderTimeoutMs float64 `json:"response_header_timeout_ms,omitempty"`
+
+	// Protocol is http1 or http2. HTTP/2 is negotiated over TLS, so against
+	// a plain http:// target both behave as HTTP/1.1.
+	Protocol           string `json:"protocol,omitempty"`
+	DisableCompression bool   `json:"disable_compression,omitempty"`
+	// MaxRedirects is how many redirects to follow; 0 returns the redirect
+	// response itself. Unset follows up to defaultMaxRedirects.
+	MaxRedirects    *int `json:"max_redirects,omitempty"`
+	InsecureSkipTLS bool `json:"insecure_skip_tls_verify,omitempty"`
+	// HashBodies computes a SHA-256 of every response body, to count how
+	// many distinct bodies an endpoint returns.
+	HashBodies bool `json:"hash_bodies,omitempty"`
+}
+
+// ConnectionStats tells how well the run's connection pool was reused.
+type ConnectionStats struct {
+	Opened   int64   `json:"opened"`
+	Open     int64   `json:"open"`
+	Reused   int64   `json:"reused"`
+	New      int64   `json:"new"`
+	WasIdle  int64   `json:"was_idle"`
+	ReusePct float64 `json:"reuse_pct"`
+}
+
+// runClient is the HTTP client of one run, counting how its connections are
+// opened and reused and timing the phases of its requests.
+type runClient struct {
+	*http.Client
+	timeout    time.Duration
+	phases     *phaseHistograms
+	hashBodies bool
+
+	opened  int64
+	open    int64
+	reused  int64
+	fresh   int64
+	wasIdle int64
+
+	wireSent     int64
+	wireReceived int64
+}
+
+func (c *ClientConfig) applyDefaults() {
+	if c.MaxIdleConnsPerHost == 0 {
+		c.MaxIdleConnsPerHost = defaultMaxIdleConns
+	}
+	if c.RequestTimeoutMs == 0 {
+		c.RequestTimeoutMs = defaultRequestTimeoutMs
+	}
+	if c.DialTimeoutMs == 0 {
+		c.DialTimeoutMs = defaultDialTimeoutMs
+	}
+	if c.TLSTimeoutMs == 0 {
+		c.TLSTimeoutMs = defaultTLSTimeoutMs
+	}
+	if c.Protocol == "" {
+		c.Protocol = protocolHTTP1
+	}
+	if c.MaxRedirects == nil {
+		n := defaultMaxRedirects
+		c.MaxRedirects = &n
+	}
+}
+
+func (c ClientConfig) validate() error {
+	if c.MaxIdleConnsPerHost < 0 || c.MaxConnsPerHost < 0 || *c.MaxRedirects < 0 {
+		return fmt.Errorf("connection limits and max_redirects must not be negative")
+	}
+	if c.RequestTimeoutMs < 0 || c.DialTimeoutMs < 0 || c.TLSTimeoutMs < 0 || c.ResponseHeaderTimeoutMs < 0 {
+		return fmt.Errorf("client timeouts must not be negative")
+	}
+	if c.Protocol != protocolHTTP1 && c.Protocol != protocolHTTP2 {
+		return fmt.Errorf("unknown protocol %q, expected %s or %s", c.Protocol, protocolHTTP1, protocolHTTP2)
+	}
+	return nil
+}
+
+func msDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+func newRunClient(cfg ClientConfig) *runClient {
+	c := &runClient{
+		timeout:    msDuration(cfg.RequestTimeoutMs),
+		phases:     newPhaseHistograms(),
+		hashBodies: cfg.HashBodies,
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   msDuration(cfg.DialTimeoutMs),
+		KeepAlive: defaultKeepAliveProbeSec * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			atomic.AddInt64(&c.opened, 1)
+			atomic.AddInt64(&c.open, 1)
+			return &countedConn{Conn: conn, client: c}, nil
+		},
+		DisableKeepAlives:     cfg.DisableKeepAlive,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   msDuration(cfg.TLSTimeoutMs),
+		ResponseHeaderTimeout: msDuration(cfg.ResponseHeaderTimeoutMs),
+		DisableCompression:    cfg.DisableCompression,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: cfg.InsecureSkipTLS},
+	}
+	if cfg.Protocol == protocolHTTP2 {
+		transport.ForceAttemptHTTP2 = true
+	} else {
+		// A non-nil empty map turns off HTTP/2 negotiation.
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	maxRedirects := *cfg.MaxRedirects
+	c.Client = &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+	return c
+}
+
+// trace counts whether a request got a new or a pooled connection and
+// returns the phase timestamps it will fill in.
+func (c *runClient) trace(ctx context.Context) (context.Context, *phaseTimes) {
+	times := &phaseTimes{}
+	trace := times.clientTrace()
+	gotConn := trace.GotConn
+	trace.GotConn = func(info httptrace.GotConnInfo) {
+		gotConn(info)
+		if !info.Reused {
+			atomic.AddInt64(&c.fresh, 1)
+			return
+		}
+		atomic.AddInt64(&c.reused, 1)
+		if info.WasIdle {
+			atomic.AddInt64(&c.wasIdle, 1)
+		}
+	}
+	return httptrace.WithClientTrace(ctx, trace), times
+}
+
+func (c *runClient) stats() ConnectionStats {
+	if c == nil {
+		return ConnectionStats{}
+	}
+	s := ConnectionStats{
+		Opened:  atomic.LoadInt64(&c.opened),
+		Open:    atomic.LoadInt64(&c.open),
+		Reused:  atomic.LoadInt64(&c.reused),
+		New:     atomic.LoadInt64(&c.fresh),
+		WasIdle: atomic.LoadInt64(&c.wasIdle),
+	}
+	if total := s.Reused + s.New; total > 0 {
+		s.ReusePct = float64(s.Reused) / float64(total) * 100
+	}
+	return s
+}
+
+func (c *runClient) phaseStats() PhaseStats {
+	if c == nil {
+		return PhaseStats{}
+	}
+	return c.phases.stats()
+}
+
+// wireBytes returns how many bytes the run's connections wrote and read.
+func (c *runClient) wireBytes() (sent, received int64) {
+	return atomic.LoadInt64(&c.wireSent), atomic.LoadInt64(&c.wireReceived)
+}
+
+func (c *runClient) close() {
+	if c != nil {
+		c.CloseIdleConnections()
+	}
+}
+
+// countedConn keeps the count of open connections of a runClient and of the
+// bytes that went through them.
+type countedConn struct {
+	net.Conn
+	client *runClient
+	once   sync.Once
+}
+
+func (c *countedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.client.wireReceived, int64(n))
+	return n, err
+}
+
+func (c *countedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.client.wireSent, int64(n))
+	return n, err
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { atomic.AddInt64(&c.client.open, -1) })
+	return c.Conn.Close()
+}
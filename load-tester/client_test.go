@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestClientRedirects(t *testing.T) {
+	// /hops/N redirects to /hops/N-1; /hops/0 answers.
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hops/"))
+		if n > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/hops/%d", n-1), http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+
+	tests := []struct {
+		max  *int
+		hops int
+		want int
+	}{
+		{nil, defaultMaxRedirects, http.StatusOK},
+		{nil, defaultMaxRedirects + 1, http.StatusFound},
+		{intPtr(0), 0, http.StatusOK},
+		{intPtr(0), 1, http.StatusFound},
+		{intPtr(2), 2, http.StatusOK},
+		{intPtr(2), 3, http.StatusFound},
+	}
+	for _, tt := range tests {
+		cfg := ClientConfig{MaxRedirects: tt.max}
+		cfg.applyDefaults()
+		c := newRunClient(cfg)
+
+		resp, err := c.Get(fmt.Sprintf("%s/hops/%d", target.URL, tt.hops))
+		if err != nil {
+			t.Fatalf("max %d, %d hops: %v", *cfg.MaxRedirects, tt.hops, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("max %d, %d hops: status %d, want %d", *cfg.MaxRedirects, tt.hops, resp.StatusCode, tt.want)
+		}
+		c.close()
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
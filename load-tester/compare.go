@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RegressionThresholds are the allowed changes of a run against its baseline.
+// A zero value disables the corresponding check.
+type RegressionThresholds struct {
+	P95IncreasePct    float64 `json:"p95_increase_pct"`
+	P99IncreasePct    float64 `json:"p99_increase_pct"`
+	ErrorRateIncrease float64 `json:"error_rate_increase"`
+	RPSDropPct        float64 `json:"rps_drop_pct"`
+}
+
+var defaultThresholds = RegressionThresholds{
+	P95IncreasePct:    10,
+	P99IncreasePct:    20,
+	ErrorRateIncrease: 1,
+	RPSDropPct:        5,
+}
+
+type MetricDelta struct {
+	Name       string  `json:"name"`
+	Base       float64 `json:"base"`
+	Current    float64 `json:"current"`
+	Delta      float64 `json:"delta"`
+	DeltaPct   float64 `json:"delta_pct"`
+	Regression bool    `json:"regression"`
+}
+
+type RunComparison struct {
+	BaseID       string               `json:"base_id"`
+	CurrentID    string               `json:"current_id"`
+	SameWorkload bool                 `json:"same_workload"`
+	Thresholds   RegressionThresholds `json:"thresholds"`
+	Metrics      []MetricDelta        `json:"metrics"`
+	Regression   bool                 `json:"regression"`
+	Reasons      []string             `json:"reasons,omitempty"`
+}
+
+type baselineConfig struct {
+	Thresholds RegressionThresholds `json:"thresholds"`
+	Baselines  map[string]string    `json:"baselines"`
+}
+
+type baselineStore struct {
+	mu sync.Mutex
+}
+
+var baselines = &baselineStore{}
+
+// workloadKey identifies what a run was hitting and how hard, so that only
+// runs of the same endpoints, rate and profile settings are compared against
+// each other's baseline.
+func workloadKey(cfg RunConfig) string {
+	var key string
+	if cfg.Replay != nil {
+		key = fmt.Sprintf("replay:%s %s x%g", cfg.Replay.File, cfg.Replay.Mode, cfg.Replay.Speed)
+	} else {
+		// Weights are compared as shares, so 70/20/10 and 7/2/1 are one
+		// workload.
+		total := 0.0
+		for _, entry := range cfg.Mix {
+			total += entry.Weight
+		}
+		parts := make([]string, 0, len(cfg.Mix))
+		for _, entry := range cfg.Mix {
+			share := 0.0
+			if total > 0 {
+				share = entry.Weight / total
+			}
+			parts = append(parts, fmt.Sprintf("%s*%g", findEndpoint(entry.Method, entry.Endpoint).Key(), math.Round(share*1e4)/1e4))
+		}
+		if len(parts) == 0 {
+			parts = append(parts, cfg.Endpoint)
+		}
+		sort.Strings(parts)
+		key = strings.Join(parts, ",")
+	}
+
+	if cfg.Users != nil {
+		key += fmt.Sprintf(" %d users, think %s", cfg.Users.Count, cfg.Users.ThinkTime)
+	} else {
+		key += fmt.Sprintf(" %d rps", cfg.RPS)
+	}
+	params, _ := json.Marshal(cfg.ProfileParams)
+	return key + " " + cfg.Profile + " " + string(params)
+}
+
+func compareRuns(base, current *RunRecord, th RegressionThresholds) *RunComparison {
+	c := &RunComparison{
+		BaseID:       base.ID,
+		CurrentID:    current.ID,
+		SameWorkload: workloadKey(base.Config) == workloadKey(current.Config),
+		Thresholds:   th,
+	}
+
+	b, cur := base.Summary, current.Summary
+	add := func(name string, baseValue, currentValue float64, regression bool) {
+		d := MetricDelta{Name: name, Base: baseValue, Current: currentValue, Delta: currentValue - baseValue, Regression: regression}
+		if baseValue != 0 {
+			d.DeltaPct = d.Delta / baseValue * 100
+		}
+		c.Metrics = append(c.Metrics, d)
+	}
+
+	add("achieved_rps", b.AchievedRPS, cur.AchievedRPS,
+		th.RPSDropPct > 0 && b.AchievedRPS > 0 && (b.AchievedRPS-cur.AchievedRPS)/b.AchievedRPS*100 > th.RPSDropPct)
+	add("error_rate", b.ErrorRate, cur.ErrorRate,
+		th.ErrorRateIncrease > 0 && cur.ErrorRate-b.ErrorRate > th.ErrorRateIncrease)
+	add("p50_ms", b.Latency.P50, cur.Latency.P50, false)
+	add("p90_ms", b.Latency.P90, cur.Latency.P90, false)
+	add("p95_ms", b.Latency.P95, cur.Latency.P95, exceedsPct(b.Latency.P95, cur.Latency.P95, th.P95IncreasePct))
+	add("p99_ms", b.Latency.P99, cur.Latency.P99, exceedsPct(b.Latency.P99, cur.Latency.P99, th.P99IncreasePct))
+	add("max_ms", b.Latency.Max, cur.Latency.Max, false)
+
+	// Runs of different workloads are shown side by side but not judged.
+	if !c.SameWorkload {
+		for i := range c.Metrics {
+			c.Metrics[i].Regression = false
+		}
+		return c
+	}
+	for _, m := range c.Metrics {
+		if m.Regression {
+			c.Regression = true
+			c.Reasons = append(c.Reasons, fmt.Sprintf("%s %.2f → %.2f (%+.1f%%)", m.Name, m.Base, m.Current, m.DeltaPct))
+		}
+	}
+	return c
+}
+
+func exceedsPct(base, current, thresholdPct float64) bool {
+	return thresholdPct > 0 && base > 0 && (current-base)/base*100 > thresholdPct
+}
+
+func (s *baselineStore) path() string {
+	return filepath.Join(dataDir(), "baselines.json")
+}
+
+func (s *baselineStore) loadLocked() (*baselineConfig, error) {
+	cfg := &baselineConfig{Thresholds: defaultThresholds, Baselines: make(map[string]string)}
+
+	data, err := os.ReadFile(s.path())
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("baselines: %w", err)
+	}
+	if cfg.Baselines == nil {
+		cfg.Baselines = make(map[string]string)
+	}
+	return cfg, nil
+}
+
+func (s *baselineStore) saveLocked(cfg *baselineConfig) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dataDir(), 0o755); err != nil {
+		return err
+	}
+	tmp := s.path() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path())
+}
+
+func (s *baselineStore) load() (*baselineConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadLocked()
+}
+
+func (s *baselineStore) update(fn func(cfg *baselineConfig)) (*baselineConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg, err := s.loadLocked()
+	if err != nil {
+		return nil, err
+	}
+	fn(cfg)
+	return cfg, s.saveLocked(cfg)
+}
+
+func (s *baselineStore) unpin(runID string) (*baselineConfig, error) {
+	return s.update(func(cfg *baselineConfig) {
+		for key, id := range cfg.Baselines {
+			if id == runID {
+				delete(cfg.Baselines, key)
+			}
+		}
+	})
+}
+
+// checkAgainstBaseline compares a finished run with the pinned baseline of its
+// workload, if there is one.
+func checkAgainstBaseline(record *RunRecord) *RunComparison {
+	// A run changed while going no longer ran the workload of its config.
+	if len(record.Events) > 0 {
+		return nil
+	}
+	cfg, err := baselines.load()
+	if err != nil {
+		log.Printf("⚠️ Failed to load baselines: %v", err)
+		return nil
+	}
+
+	baseID, ok := cfg.Baselines[workloadKey(record.Config)]
+	if !ok || baseID == record.ID {
+		return nil
+	}
+	base, err := runs.get(baseID)
+	if err != nil {
+		log.Printf("⚠️ Failed to load baseline run %s: %v", baseID, err)
+		return nil
+	}
+	return compareRuns(base, record, cfg.Thresholds)
+}
+
+func compareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentID := r.URL.Query().Get("current")
+	current, err := runs.get(currentID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Run %q not found", currentID), http.StatusNotFound)
+		return
+	}
+
+	cfg, err := baselines.load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	baseID := r.URL.Query().Get("base")
+	if baseID == "" {
+		baseID = cfg.Baselines[workloadKey(current.Config)]
+		if baseID == "" {
+			http.Error(w, "No baseline pinned for this workload, pass ?base=", http.StatusBadRequest)
+			return
+		}
+	}
+	base, err := runs.get(baseID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Run %q not found", baseID), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(compareRuns(base, current, cfg.Thresholds))
+}
+
+func baselinesHandler(w http.ResponseWriter, r *http.Request) {
+	var cfg *baselineConfig
+	var err error
+
+	switch r.Method {
+	case "GET":
+		cfg, err = baselines.load()
+
+	case "POST":
+		var req struct {
+			RunID      string                `json:"run_id"`
+			Thresholds *RegressionThresholds `json:"thresholds"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var record *RunRecord
+		if req.RunID != "" {
+			if record, err = runs.get(req.RunID); err != nil {
+				http.Error(w, fmt.Sprintf("Run %q not found", req.RunID), http.StatusNotFound)
+				return
+			}
+		}
+		if req.Thresholds != nil {
+			t := *req.Thresholds
+			if t.P95IncreasePct < 0 || t.P99IncreasePct < 0 || t.ErrorRateIncrease < 0 || t.RPSDropPct < 0 {
+				http.Error(w, "thresholds must not be negative", http.StatusBadRequest)
+				return
+			}
+		}
+
+		cfg, err = baselines.update(func(cfg *baselineConfig) {
+			if record != nil {
+				cfg.Baselines[workloadKey(record.Config)] = record.ID
+			}
+			if req.Thresholds != nil {
+				cfg.Thresholds = *req.Thresholds
+			}
+		})
+		if err == nil && record != nil {
+			log.Printf("📌 Pinned run %s as baseline for %s", record.ID, workloadKey(record.Config))
+		}
+
+	case "DELETE":
+		cfg, err = baselines.unpin(r.URL.Query().Get("run_id"))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg)
+}
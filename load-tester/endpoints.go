@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var endpointsMutex sync.RWMutex
+
+var allowedMethods = map[string]bool{
+	"GET":     true,
+	"POST":    true,
+	"PUT":     true,
+	"PATCH":   true,
+	"DELETE":  true,
+	"HEAD":    true,
+	"OPTIONS": true,
+}
+
+type endpointTemplates struct {
+	path    *template.Template
+	query   map[string]*template.Template
+	headers map[string]*template.Template
+	body    *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"randInt": func(min, max int) int {
+		if max <= min {
+			return min
+		}
+		return min + mathrand.Intn(max-min+1)
+	},
+	"randFloat": func(min, max float64) string {
+		return strconv.FormatFloat(min+mathrand.Float64()*(max-min), 'f', 2, 64)
+	},
+	"pick": func(items ...interface{}) interface{} {
+		if len(items) == 0 {
+			return ""
+		}
+		return items[mathrand.Intn(len(items))]
+	},
+	"randString": func(n int) string {
+		const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = letters[mathrand.Intn(len(letters))]
+		}
+		return string(b)
+	},
+	"uuid":        newUUID,
+	"timestamp":   func() int64 { return time.Now().Unix() },
+	"timestampMs": func() int64 { return time.Now().UnixMilli() },
+	"now":         func() string { return time.Now().Format(time.RFC3339) },
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"pathEscape": func(v interface{}) string {
+		return url.PathEscape(fmt.Sprint(v))
+	},
+}
+
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		for i := range b {
+			b[i] = byte(mathrand.Intn(256))
+		}
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+}
+
+func renderTemplate(t *template.Template, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (ep *EndpointConfig) compile() error {
+	ep.Method = strings.ToUpper(strings.TrimSpace(ep.Method))
+	if ep.Method == "" {
+		ep.Method = "GET"
+	}
+	if !allowedMethods[ep.Method] {
+		return fmt.Errorf("unsupported method %q", ep.Method)
+	}
+	if !strings.HasPrefix(ep.Path, "/") {
+		return fmt.Errorf("path %q must start with /", ep.Path)
+	}
+	if ep.Name == "" {
+		ep.Name = ep.Method + " " + ep.Path
+	}
+	ep.NeedsBody = ep.Body != ""
+
+	t := &endpointTemplates{
+		query:   make(map[string]*template.Template, len(ep.Query)),
+		headers: make(map[string]*template.Template, len(ep.Headers)),
+	}
+
+	var err error
+	if t.path, err = parseTemplate("path", ep.Path); err != nil {
+		return fmt.Errorf("path template: %w", err)
+	}
+	for k, v := range ep.Query {
+		if t.query[k], err = parseTemplate("query."+k, v); err != nil {
+			return fmt.Errorf("query %s template: %w", k, err)
+		}
+	}
+	for k, v := range ep.Headers {
+		if t.headers[k], err = parseTemplate("header."+k, v); err != nil {
+			return fmt.Errorf("header %s template: %w", k, err)
+		}
+	}
+	if ep.Body != "" {
+		if t.body, err = parseTemplate("body", ep.Body); err != nil {
+			return fmt.Errorf("body template: %w", err)
+		}
+	}
+
+	if ep.Assert != nil {
+		if err := ep.Assert.compile(); err != nil {
+			return fmt.Errorf("assert: %w", err)
+		}
+	}
+
+	ep.templates = t
+	return nil
+}
+
+func (ep EndpointConfig) newRequest(ctx context.Context, baseURL string, data interface{}) (*http.Request, error) {
+	if ep.templates == nil {
+		if err := ep.compile(); err != nil {
+			return nil, err
+		}
+	}
+	t := ep.templates
+
+	path, err := renderTemplate(t.path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	target := baseURL + path
+	if len(t.query) > 0 {
+		query := url.Values{}
+		for k, qt := range t.query {
+			v, err := renderTemplate(qt, data)
+			if err != nil {
+				return nil, err
+			}
+			query.Set(k, v)
+		}
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + query.Encode()
+	}
+
+	var body io.Reader
+	var bodyText string
+	if t.body != nil {
+		if bodyText, err = renderTemplate(t.body, data); err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(bodyText)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, ep.Method, target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", "AnimalShelter-LoadTester/1.0")
+	if t.body != nil {
+		trimmed := strings.TrimSpace(bodyText)
+		if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			req.Header.Set("Content-Type", "application/json")
+		} else {
+			req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		}
+	}
+	for k, ht := range t.headers {
+		v, err := renderTemplate(ht, data)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(k, v)
+	}
+
+	return req, nil
+}
+
+func initEndpoints() error {
+	endpointsMutex.Lock()
+	for i := range endpoints {
+		if err := endpoints[i].compile(); err != nil {
+			endpointsMutex.Unlock()
+			return fmt.Errorf("built-in endpoint %s: %w", endpoints[i].Path, err)
+		}
+	}
+	endpointsMutex.Unlock()
+
+	if path := os.Getenv("ENDPOINTS_FILE"); path != "" {
+		return loadEndpointsFile(path)
+	}
+	return nil
+}
+
+func loadEndpointsFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var list []EndpointConfig
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if _, err := registerEndpoints(list); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	log.Printf("📄 Loaded %d endpoints from %s", len(list), path)
+	return nil
+}
+
+func listEndpoints() []EndpointConfig {
+	endpointsMutex.RLock()
+	defer endpointsMutex.RUnlock()
+
+	list := make([]EndpointConfig, len(endpoints))
+	copy(list, endpoints)
+	return list
+}
+
+func findEndpoint(method, path string) EndpointConfig {
+	if method == scenarioMethod {
+		if s, ok := findScenario(path); ok {
+			return s.endpoint()
+		}
+		return EndpointConfig{Name: path, Method: method, Path: path}
+	}
+
+	endpointsMutex.RLock()
+	defer endpointsMutex.RUnlock()
+
+	for _, ep := range endpoints {
+		if ep.Path == path && (method == "" || ep.Method == method) {
+			return ep
+		}
+	}
+	if method == "" {
+		method = "GET"
+	}
+	return EndpointConfig{Name: path, Method: method, Path: path}
+}
+
+func registerEndpoint(ep EndpointConfig) (EndpointConfig, error) {
+	ep.Custom = true
+	if err := ep.compile(); err != nil {
+		return ep, err
+	}
+	return ep, addEndpoints([]EndpointConfig{ep})
+}
+
+// registerEndpoints adds or replaces the custom endpoints in list. Every entry
+// is checked before any is registered, so an invalid one leaves the endpoints
+// unchanged.
+func registerEndpoints(list []EndpointConfig) ([]EndpointConfig, error) {
+	compiled := make([]EndpointConfig, len(list))
+	for i, ep := range list {
+		ep.Custom = true
+		if err := ep.compile(); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", ep.Method, ep.Path, err)
+		}
+		compiled[i] = ep
+	}
+	if err := addEndpoints(compiled); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+// addEndpoints registers compiled custom endpoints, replacing custom ones with
+// the same key, or none of them if any would replace a built-in endpoint.
+func addEndpoints(list []EndpointConfig) error {
+	endpointsMutex.Lock()
+	defer endpointsMutex.Unlock()
+
+	for _, ep := range list {
+		for i := range endpoints {
+			if endpoints[i].Key() == ep.Key() && !endpoints[i].Custom {
+				return fmt.Errorf("built-in endpoint %s cannot be replaced", ep.Key())
+			}
+		}
+	}
+
+	for _, ep := range list {
+		replaced := false
+		for i := range endpoints {
+			if endpoints[i].Key() == ep.Key() {
+				endpoints[i] = ep
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			endpoints = append(endpoints, ep)
+		}
+	}
+	return nil
+}
+
+func removeEndpoint(method, path string) (bool, error) {
+	endpointsMutex.Lock()
+	defer endpointsMutex.Unlock()
+
+	key := strings.ToUpper(method) + " " + path
+	for i := range endpoints {
+		if endpoints[i].Key() != key {
+			continue
+		}
+		if !endpoints[i].Custom {
+			return false, fmt.Errorf("built-in endpoint %s cannot be removed", key)
+		}
+		endpoints = append(endpoints[:i], endpoints[i+1:]...)
+		return true, nil
+	}
+	return false, nil
+}
+
+func endpointsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(listEndpoints())
+
+	case "POST":
+		var raw json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var list []EndpointConfig
+		if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+			if err := json.Unmarshal(raw, &list); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		} else {
+			var ep EndpointConfig
+			if err := json.Unmarshal(raw, &ep); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			list = append(list, ep)
+		}
+
+		registered, err := registerEndpoints(list)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, ep := range registered {
+			log.Printf("➕ Registered endpoint %s", ep.Key())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(registered)
+
+	case "DELETE":
+		method := r.URL.Query().Get("method")
+		path := r.URL.Query().Get("path")
+		if method == "" {
+			method = "GET"
+		}
+
+		removed, err := removeEndpoint(method, path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !removed {
+			http.Error(w, "Endpoint not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("➖ Removed endpoint %s %s", strings.ToUpper(method), path)
+		fmt.Fprintf(w, "Removed")
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+const (
+	errorClassTimeout           = "timeout"
+	errorClassConnectionRefused = "connection_refused"
+	errorClassConnectionReset   = "connection_reset"
+	errorClassDNS               = "dns"
+	errorClassTLS               = "tls"
+	errorClassContextCancelled  = "context_cancelled"
+	errorClassBodyTruncated     = "body_truncated"
+	errorClassOther             = "other"
+)
+
+func classifyError(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return errorClassContextCancelled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorClassTimeout
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return errorClassTimeout
+		}
+		return errorClassDNS
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errorClassTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return errorClassConnectionRefused
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return errorClassConnectionReset
+	}
+
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &recordErr) || errors.As(err, &certErr) || errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) || strings.Contains(err.Error(), "tls: ") {
+		return errorClassTLS
+	}
+
+	return errorClassOther
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	eventSnapshot          = "snapshot"
+	eventSample            = "sample"
+	eventStarted           = "started"
+	eventStageChanged      = "stage_changed"
+	eventThresholdBreached = "threshold_breached"
+	eventStopped           = "stopped"
+	eventRunChanged        = "run_changed"
+
+	eventBuffer       = 64
+	eventHeartbeatSec = 15
+)
+
+// Event is one message of the /events stream, with its data already encoded
+// so that it is marshalled once however many clients are subscribed.
+type Event struct {
+	Type string
+	Data []byte
+}
+
+type StartedEvent struct {
+	RunID       string    `json:"run_id"`
+	Description string    `json:"description"`
+	Config      RunConfig `json:"config"`
+}
+
+type StageChangedEvent struct {
+	RunID     string  `json:"run_id"`
+	Stage     int     `json:"stage"`
+	Elapsed   float64 `json:"elapsed_sec"`
+	TargetRPS int     `json:"target_rps"`
+}
+
+type ThresholdBreachedEvent struct {
+	RunID  string  `json:"run_id"`
+	Expr   string  `json:"expr"`
+	Actual float64 `json:"actual"`
+}
+
+type StoppedEvent struct {
+	RunID   string      `json:"run_id"`
+	Reason  string      `json:"reason"`
+	Summary *RunSummary `json:"summary"`
+}
+
+// eventHub fans events out to the /events subscribers. Publishing never
+// blocks: a subscriber that falls more than eventBuffer events behind misses
+// the rest until it catches up, which for per-second snapshots only means a
+// skipped frame.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+var events = &eventHub{subscribers: make(map[chan Event]struct{})}
+
+func newEvent(typ string, data interface{}) Event {
+	b, err := json.Marshal(data)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	return Event{Type: typ, Data: b}
+}
+
+func (h *eventHub) subscribe() chan Event {
+	ch := make(chan Event, eventBuffer)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	delete(h.subscribers, ch)
+	h.mu.Unlock()
+}
+
+func (h *eventHub) active() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers) > 0
+}
+
+func (h *eventHub) publish(typ string, data interface{}) {
+	if !h.active() {
+		return
+	}
+	e := newEvent(typ, data)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func writeEvent(w io.Writer, e Event) error {
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, e.Data)
+	return err
+}
+
+// eventsHandler streams run events as Server-Sent Events. A new subscriber
+// first gets a snapshot of the current state. ?types=started,stopped limits
+// the stream to the given event types.
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var types map[string]bool
+	if list := r.URL.Query().Get("types"); list != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(list, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+	wanted := func(typ string) bool {
+		return types == nil || types[typ]
+	}
+
+	ch := events.subscribe()
+	defer events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if wanted(eventSnapshot) {
+		writeEvent(w, newEvent(eventSnapshot, loadTester.snapshot()))
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatSec * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-ch:
+			if !wanted(e.Type) {
+				continue
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
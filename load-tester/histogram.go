@@ -0,0 +1,156 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+const (
+	histSubBucketBits = 7
+	histSubBuckets    = 1 << histSubBucketBits
+	histMaxValue      = int64(time.Hour / time.Microsecond)
+)
+
+// Histogram is a log-linear (HDR-style) latency histogram with microsecond
+// resolution: every power-of-two range is split into histSubBuckets linear
+// buckets, so any reported percentile is within 1% of the recorded value.
+type Histogram struct {
+	mu         sync.Mutex
+	counts     []int64
+	count      int64
+	min        int64
+	max        int64
+	sum        float64
+	sumSquares float64
+}
+
+type LatencyStats struct {
+	Count  int64   `json:"count"`
+	Min    float64 `json:"min_ms"`
+	Mean   float64 `json:"mean_ms"`
+	StdDev float64 `json:"stddev_ms"`
+	P50    float64 `json:"p50_ms"`
+	P90    float64 `json:"p90_ms"`
+	P95    float64 `json:"p95_ms"`
+	P99    float64 `json:"p99_ms"`
+	P999   float64 `json:"p999_ms"`
+	Max    float64 `json:"max_ms"`
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{
+		counts: make([]int64, histBucketIndex(histMaxValue)+1),
+	}
+}
+
+func histBucketIndex(v int64) int {
+	if v < 2*histSubBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - histSubBucketBits - 1
+	return (shift+1)*histSubBuckets + int(v>>shift) - histSubBuckets
+}
+
+func histBucketUpperBound(idx int) int64 {
+	if idx < 2*histSubBuckets {
+		return int64(idx)
+	}
+	shift := idx/histSubBuckets - 1
+	sub := int64(idx%histSubBuckets + histSubBuckets)
+	return (sub+1)<<shift - 1
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d / time.Microsecond)
+	if v < 0 {
+		v = 0
+	}
+	if v > histMaxValue {
+		v = histMaxValue
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.counts[histBucketIndex(v)]++
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += float64(v)
+	h.sumSquares += float64(v) * float64(v)
+}
+
+func (h *Histogram) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := range h.counts {
+		h.counts[i] = 0
+	}
+	h.count = 0
+	h.min = 0
+	h.max = 0
+	h.sum = 0
+	h.sumSquares = 0
+}
+
+func (h *Histogram) Stats() LatencyStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.count == 0 {
+		return LatencyStats{}
+	}
+
+	mean := h.sum / float64(h.count)
+	variance := h.sumSquares/float64(h.count) - mean*mean
+	if variance < 0 {
+		variance = 0
+	}
+
+	return LatencyStats{
+		Count:  h.count,
+		Min:    usToMs(h.min),
+		Mean:   mean / 1000,
+		StdDev: math.Sqrt(variance) / 1000,
+		P50:    usToMs(h.valueAtPercentile(50)),
+		P90:    usToMs(h.valueAtPercentile(90)),
+		P95:    usToMs(h.valueAtPercentile(95)),
+		P99:    usToMs(h.valueAtPercentile(99)),
+		P999:   usToMs(h.valueAtPercentile(99.9)),
+		Max:    usToMs(h.max),
+	}
+}
+
+func (h *Histogram) valueAtPercentile(p float64) int64 {
+	target := int64(math.Ceil(p / 100 * float64(h.count)))
+	if target < 1 {
+		target = 1
+	}
+
+	var seen int64
+	for idx, c := range h.counts {
+		seen += c
+		if seen >= target {
+			v := histBucketUpperBound(idx)
+			if v > h.max {
+				v = h.max
+			}
+			if v < h.min {
+				v = h.min
+			}
+			return v
+		}
+	}
+	return h.max
+}
+
+func usToMs(v int64) float64 {
+	return float64(v) / 1000
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistogramBucketBounds(t *testing.T) {
+	prev := int64(-1)
+	for idx := 0; idx <= histBucketIndex(histMaxValue); idx++ {
+		upper := histBucketUpperBound(idx)
+		if upper <= prev {
+			t.Fatalf("bucket %d ends at %d, not after bucket %d at %d", idx, upper, idx-1, prev)
+		}
+		if got := histBucketIndex(upper); got != idx {
+			t.Fatalf("upper bound %d of bucket %d maps to bucket %d", upper, idx, got)
+		}
+		if got := histBucketIndex(prev + 1); got != idx {
+			t.Fatalf("lower bound %d of bucket %d maps to bucket %d", prev+1, idx, got)
+		}
+		// Buckets past the linear range are at most 1% of their values wide.
+		if width := upper - prev; prev >= 2*histSubBuckets && float64(width)/float64(prev+1) > 0.01 {
+			t.Fatalf("bucket %d is %d wide at %d", idx, width, prev+1)
+		}
+		prev = upper
+	}
+}
+
+func TestHistogramStats(t *testing.T) {
+	h := NewHistogram()
+	if s := h.Stats(); s != (LatencyStats{}) {
+		t.Errorf("empty histogram: %+v", s)
+	}
+
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	s := h.Stats()
+
+	if s.Count != 1000 || s.Min != 1 || s.Max != 1000 {
+		t.Errorf("count %d, min %g, max %g", s.Count, s.Min, s.Max)
+	}
+	if math.Abs(s.Mean-500.5) > 0.01 {
+		t.Errorf("mean %g, want 500.5", s.Mean)
+	}
+	if math.Abs(s.StdDev-288.67) > 0.01 {
+		t.Errorf("stddev %g, want 288.67", s.StdDev)
+	}
+	within := func(name string, got, want float64) {
+		if math.Abs(got-want) > want/100 {
+			t.Errorf("%s %g, want %g within 1%%", name, got, want)
+		}
+	}
+	within("p50", s.P50, 500)
+	within("p90", s.P90, 900)
+	within("p95", s.P95, 950)
+	within("p99", s.P99, 990)
+	within("p999", s.P999, 999)
+}
+
+func TestHistogramClamp(t *testing.T) {
+	h := NewHistogram()
+	h.Record(-time.Millisecond)
+	h.Record(2 * time.Hour)
+
+	s := h.Stats()
+	if s.Min != 0 || s.Max != usToMs(histMaxValue) {
+		t.Errorf("min %g, max %g", s.Min, s.Max)
+	}
+}
+
+func TestHistogramReset(t *testing.T) {
+	h := NewHistogram()
+	h.Record(time.Second)
+	h.Reset()
+	if s := h.Stats(); s.Count != 0 {
+		t.Fatalf("after reset: %+v", s)
+	}
+
+	h.Record(5 * time.Millisecond)
+	if s := h.Stats(); s.Count != 1 || s.Min != 5 || s.Max != 5 || s.P99 != 5 {
+		t.Errorf("after reset and record: %+v", s)
+	}
+}
+
+func TestHistogramConcurrentRecord(t *testing.T) {
+	h := NewHistogram()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				h.Record(time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if s := h.Stats(); s.Count != 8000 || s.P50 != 1 {
+		t.Errorf("%+v", s)
+	}
+}
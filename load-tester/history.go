@@ -0,0 +1,558 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+const historyHTML = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>История запусков — Нагрузочное тестирование</title>
+    <style>STYLES_PLACEHOLDER
+        .runs-table td:last-child {
+            white-space: nowrap;
+        }
+        .runs-table tr.selected td {
+            background: #e3f2fd;
+        }
+        .small-btn {
+            flex: none;
+            padding: 6px 10px;
+            font-size: 14px;
+            background: #e9ecef;
+            color: #495057;
+        }
+        .timeline-wrap {
+            max-height: 400px;
+            overflow-y: auto;
+        }
+        #run-details, #comparison-section, .thresholds-section {
+            margin-top: 30px;
+        }
+        .runs-toolbar {
+            display: flex;
+            gap: 15px;
+            margin-bottom: 15px;
+        }
+        .runs-toolbar button {
+            flex: none;
+            padding: 10px 20px;
+            background: linear-gradient(135deg, #00d2ff, #3a7bd5);
+            color: white;
+        }
+        .run-badge {
+            display: inline-block;
+            padding: 2px 6px;
+            margin-left: 6px;
+            border-radius: 4px;
+            font-size: 12px;
+            font-weight: bold;
+            color: white;
+        }
+        .badge-baseline { background: #6f42c1; }
+        .badge-regression { background: #dc3545; }
+        .badge-ok { background: #28a745; }
+        .endpoint-table tr.regression td {
+            color: #dc3545;
+            font-weight: bold;
+        }
+        .thresholds-grid {
+            display: grid;
+            grid-template-columns: repeat(4, 1fr);
+            gap: 15px;
+        }
+        .comparison-warning {
+            background: #fff3cd;
+            padding: 10px 15px;
+            border-radius: 8px;
+            margin-bottom: 15px;
+        }
+    </style>
+    <script>
+CHARTS_SCRIPT_PLACEHOLDER
+        const stopReasonNames = {
+            manual: 'остановлен вручную',
+            duration: 'истекла длительность',
+            max_requests: 'достигнут лимит запросов',
+            source_exhausted: 'закончились запросы для воспроизведения',
+            shutdown: 'завершение работы',
+            threshold: 'нарушен порог SLO'
+        };
+
+        const metricNames = {
+            achieved_rps: 'RPS (факт)',
+            error_rate: 'Ошибок, %',
+            p50_ms: 'p50, мс',
+            p90_ms: 'p90, мс',
+            p95_ms: 'p95, мс',
+            p99_ms: 'p99, мс',
+            max_ms: 'max, мс'
+        };
+
+        let selectedRun = null;
+        let pinnedRuns = {};
+
+        function describeConfig(config) {
+            return describeSource(config) + (config.users ? ' · 👥 ' + config.users.count : '');
+        }
+
+        function describeSource(config) {
+            if (config.replay) {
+                return '📼 ' + escapeHTML(config.replay.file) + ' (' + config.replay.mode + ')';
+            }
+            const mix = config.mix || [];
+            if (mix.length <= 1) {
+                return escapeHTML(config.endpoint);
+            }
+            const total = mix.reduce(function (sum, entry) { return sum + entry.weight; }, 0);
+            return mix.map(function (entry) {
+                return (entry.weight / total * 100).toFixed(0) + '% ' + escapeHTML(entry.endpoint);
+            }).join(', ');
+        }
+
+        async function loadRuns() {
+            try {
+                const response = await fetch('/runs');
+                const runs = await response.json();
+                const list = document.getElementById('runs');
+                await loadBaselines();
+
+                if (runs.length === 0) {
+                    list.innerHTML = '<div class="breakdown-empty">Сохранённых запусков пока нет</div>';
+                    return;
+                }
+
+                list.innerHTML =
+                    '<table class="endpoint-table runs-table"><tr>' +
+                    '<th></th><th>Запуск</th><th>Нагрузка</th><th>Профиль</th><th>Запросов</th><th>Ошибок</th><th>RPS</th><th>p95</th><th></th>' +
+                    '</tr>' +
+                    runs.map(function (run) {
+                        const s = run.summary;
+                        return '<tr class="' + (run.id === selectedRun ? 'selected' : '') + '">' +
+                            '<td><input type="checkbox" class="run-select" value="' + run.id + '"></td>' +
+                            '<td>' + new Date(s.start_time).toLocaleString() + runBadges(run) + '<br><small>' + run.id + '</small></td>' +
+                            '<td>' + describeConfig(run.config) + '</td>' +
+                            '<td>' + run.config.profile + '</td>' +
+                            '<td>' + s.total_requests + '</td>' +
+                            '<td>' + s.error_rate.toFixed(2) + '%</td>' +
+                            '<td>' + s.achieved_rps.toFixed(1) + '</td>' +
+                            '<td>' + s.latency.p95_ms.toFixed(1) + ' мс</td>' +
+                            '<td>' +
+                            '<button class="small-btn" onclick="showRun(\'' + run.id + '\')">🔍</button> ' +
+                            (pinnedRuns[run.id] ?
+                                '<button class="small-btn" title="Снять эталон" onclick="unpinRun(\'' + run.id + '\')">📍</button> ' :
+                                '<button class="small-btn" title="Сделать эталоном" onclick="pinRun(\'' + run.id + '\')">📌</button> ') +
+                            '<button class="small-btn" onclick="deleteRun(\'' + run.id + '\')">🗑️</button>' +
+                            '</td>' +
+                            '</tr>';
+                    }).join('') +
+                    '</table>';
+            } catch (error) {
+                console.error('Ошибка загрузки истории:', error);
+            }
+        }
+
+        function runBadges(run) {
+            let badges = '';
+            if (pinnedRuns[run.id]) {
+                badges += '<span class="run-badge badge-baseline">эталон</span>';
+            }
+            if (run.summary.thresholds) {
+                badges += run.summary.failed ?
+                    '<span class="run-badge badge-regression">❌ SLO</span>' :
+                    '<span class="run-badge badge-ok">SLO</span>';
+            }
+            if (run.comparison) {
+                badges += run.comparison.regression ?
+                    '<span class="run-badge badge-regression">🚨 регрессия</span>' :
+                    '<span class="run-badge badge-ok">в норме</span>';
+            }
+            return badges;
+        }
+
+        async function loadBaselines() {
+            const response = await fetch('/baselines');
+            const config = await response.json();
+
+            pinnedRuns = {};
+            Object.keys(config.baselines).forEach(function (key) {
+                pinnedRuns[config.baselines[key]] = true;
+            });
+
+            const t = config.thresholds;
+            document.getElementById('th-p95').value = t.p95_increase_pct;
+            document.getElementById('th-p99').value = t.p99_increase_pct;
+            document.getElementById('th-errors').value = t.error_rate_increase;
+            document.getElementById('th-rps').value = t.rps_drop_pct;
+        }
+
+        async function postBaselines(body) {
+            try {
+                const response = await fetch('/baselines', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify(body)
+                });
+                if (!response.ok) {
+                    alert('Ошибка: ' + await response.text());
+                }
+                loadRuns();
+            } catch (error) {
+                alert('Ошибка подключения: ' + error.message);
+            }
+        }
+
+        function pinRun(id) {
+            postBaselines({ run_id: id });
+        }
+
+        async function unpinRun(id) {
+            try {
+                await fetch('/baselines?run_id=' + encodeURIComponent(id), { method: 'DELETE' });
+                loadRuns();
+            } catch (error) {
+                alert('Ошибка подключения: ' + error.message);
+            }
+        }
+
+        function saveThresholds() {
+            const number = function (id) {
+                return parseFloat(document.getElementById(id).value) || 0;
+            };
+            postBaselines({
+                thresholds: {
+                    p95_increase_pct: number('th-p95'),
+                    p99_increase_pct: number('th-p99'),
+                    error_rate_increase: number('th-errors'),
+                    rps_drop_pct: number('th-rps')
+                }
+            });
+        }
+
+        async function compareSelected() {
+            const ids = Array.from(document.querySelectorAll('.run-select:checked')).map(function (box) {
+                return box.value;
+            });
+            if (ids.length !== 2) {
+                alert('Выберите ровно два запуска для сравнения');
+                return;
+            }
+
+            // Идентификаторы начинаются с времени запуска, поэтому более ранний запуск — базовый.
+            ids.sort();
+            try {
+                const response = await fetch('/compare?base=' + ids[0] + '&current=' + ids[1]);
+                if (!response.ok) {
+                    alert('Ошибка: ' + await response.text());
+                    return;
+                }
+                renderComparison(await response.json(), document.getElementById('comparison'));
+                document.getElementById('comparison-section').style.display = 'block';
+            } catch (error) {
+                alert('Ошибка подключения: ' + error.message);
+            }
+        }
+
+        function renderComparison(c, target) {
+            target.innerHTML =
+                (c.same_workload ? '' :
+                    '<div class="comparison-warning">⚠️ Запуски отличаются эндпоинтами, нагрузкой или параметрами профиля — регрессии не оцениваются</div>') +
+                '<div class="summary-meta">Базовый: ' + c.base_id + ' → текущий: ' + c.current_id +
+                (c.regression ? '<span class="run-badge badge-regression">🚨 регрессия</span>' :
+                    '<span class="run-badge badge-ok">в норме</span>') +
+                '</div>' +
+                '<table class="endpoint-table"><tr>' +
+                '<th>Метрика</th><th>Базовый</th><th>Текущий</th><th>Разница</th><th>Разница, %</th>' +
+                '</tr>' +
+                c.metrics.map(function (m) {
+                    return '<tr class="' + (m.regression ? 'regression' : '') + '">' +
+                        '<td>' + (metricNames[m.name] || m.name) + '</td>' +
+                        '<td>' + m.base.toFixed(2) + '</td>' +
+                        '<td>' + m.current.toFixed(2) + '</td>' +
+                        '<td>' + (m.delta >= 0 ? '+' : '') + m.delta.toFixed(2) + '</td>' +
+                        '<td>' + (m.delta_pct >= 0 ? '+' : '') + m.delta_pct.toFixed(1) + '%</td>' +
+                        '</tr>';
+                }).join('') +
+                '</table>';
+        }
+
+        async function showRun(id) {
+            try {
+                const response = await fetch('/runs/' + id);
+                if (!response.ok) {
+                    alert('Ошибка: ' + await response.text());
+                    return;
+                }
+                const run = await response.json();
+                selectedRun = id;
+                renderRun(run);
+                loadRuns();
+            } catch (error) {
+                alert('Ошибка подключения: ' + error.message);
+            }
+        }
+
+        async function deleteRun(id) {
+            if (!confirm('Удалить запуск ' + id + '?')) return;
+
+            try {
+                const response = await fetch('/runs/' + id, { method: 'DELETE' });
+                if (!response.ok) {
+                    alert('Ошибка: ' + await response.text());
+                }
+                if (selectedRun === id) {
+                    selectedRun = null;
+                    document.getElementById('run-details').style.display = 'none';
+                }
+                loadRuns();
+            } catch (error) {
+                alert('Ошибка подключения: ' + error.message);
+            }
+        }
+
+        function endpointRow(e, cls, prefix) {
+            return '<tr class="' + cls + '">' +
+                '<td>' + (prefix || '') + '<span class="method-badge method-' + e.method + '">' + e.method + '</span>' + escapeHTML(e.path) + '</td>' +
+                '<td>' + (cls ? '' : (e.share * 100).toFixed(0) + '%') + '</td>' +
+                '<td>' + e.total_requests + '</td>' +
+                '<td>' + e.error_requests + '</td>' +
+                '<td>' + (e.assertion_failures || 0) + '</td>' +
+                '<td>' + e.latency.p50_ms.toFixed(1) + ' мс</td>' +
+                '<td>' + e.latency.p95_ms.toFixed(1) + ' мс</td>' +
+                '<td>' + e.latency.p99_ms.toFixed(1) + ' мс</td>' +
+                '<td>' + (e.corrected_latency ? e.corrected_latency.p99_ms.toFixed(1) + ' мс' : '—') + '</td>' +
+                '<td>' + (e.traffic && !e.steps ? formatBytes(e.traffic.avg_response_bytes) +
+                    (e.distinct_bodies ? ' (' + e.distinct_bodies + ' разных)' : '') : '') + '</td>' +
+                '<td>' + (e.traffic && !e.steps ? e.traffic.received_mb_per_sec.toFixed(2) : '') + '</td>' +
+                '</tr>';
+        }
+
+        const phaseNames = [
+            ['conn_wait', 'Ожидание соединения'], ['dns', 'DNS'], ['connect', 'TCP-соединение'], ['tls', 'TLS'],
+            ['ttfb', 'До первого байта'], ['transfer', 'Передача тела']
+        ];
+
+        function renderPhases(phases) {
+            return '<table class="endpoint-table"><tr>' +
+                '<th>Фаза</th><th>Запросов</th><th>p50</th><th>p95</th><th>p99</th><th>max</th>' +
+                '</tr>' +
+                phaseNames.filter(function (phase) {
+                    return phases[phase[0]];
+                }).map(function (phase) {
+                    const s = phases[phase[0]];
+                    return '<tr>' +
+                        '<td>' + phase[1] + '</td>' +
+                        '<td>' + s.count + '</td>' +
+                        '<td>' + s.p50_ms.toFixed(2) + ' мс</td>' +
+                        '<td>' + s.p95_ms.toFixed(2) + ' мс</td>' +
+                        '<td>' + s.p99_ms.toFixed(2) + ' мс</td>' +
+                        '<td>' + s.max_ms.toFixed(2) + ' мс</td>' +
+                        '</tr>';
+                }).join('') +
+                '</table>';
+        }
+
+        function renderRun(run) {
+            const s = run.summary;
+            const items = [
+                ['Всего запросов', s.total_requests],
+                ['Ошибок', s.error_rate.toFixed(2) + '%'],
+                !s.target_rps ? ['RPS (факт)', s.achieved_rps.toFixed(1)] :
+                    ['RPS (факт / цель)', s.achieved_rps.toFixed(1) + ' / ' + s.target_rps.toFixed(1)],
+                ['p50', s.latency.p50_ms.toFixed(1) + ' мс'],
+                ['p95', s.latency.p95_ms.toFixed(1) + ' мс'],
+                ['p99', s.latency.p99_ms.toFixed(1) + ' мс'],
+                ['max', s.latency.max_ms.toFixed(1) + ' мс'],
+                ['p99 с поправкой', s.corrected_latency ? s.corrected_latency.p99_ms.toFixed(1) + ' мс' : '—'],
+                ['Соединений / переиспользование', s.connections ?
+                    s.connections.opened + ' / ' + s.connections.reuse_pct.toFixed(1) + '%' : '—'],
+                ['Получено / отправлено', s.traffic ?
+                    formatBytes(s.traffic.bytes_received) + ' / ' + formatBytes(s.traffic.bytes_sent) : '—'],
+                ['МБ/с получено', s.traffic ? s.traffic.received_mb_per_sec.toFixed(2) : '—'],
+                ['Длительность', s.duration_sec.toFixed(0) + 's']
+            ];
+
+            document.getElementById('run-title').innerHTML = '📋 Запуск ' + run.id;
+            document.getElementById('run-summary').innerHTML =
+                '<div class="summary-meta">' +
+                new Date(s.start_time).toLocaleString() + ' — ' + new Date(s.end_time).toLocaleString() +
+                ' (' + (stopReasonNames[s.stop_reason] || s.stop_reason) + ')<br>' +
+                describeConfig(run.config) + ', профиль ' + run.config.profile +
+                (run.config.users ? '' : ', ' + run.config.rps + ' RPS') +
+                '</div>' +
+                '<div class="status-grid latency-grid">' +
+                items.map(function (item) {
+                    return '<div class="status-item">' +
+                        '<div class="status-value">' + item[1] + '</div>' +
+                        '<div class="status-label">' + item[0] + '</div>' +
+                        '</div>';
+                }).join('') +
+                '</div>' +
+                (s.thresholds || []).map(function (t) {
+                    return '<div class="breakdown-row">' +
+                        '<span>' + (t.passed ? '✅ ' : '❌ ') + escapeHTML(t.expr) + (t.aborted ? ' (тест прерван)' : '') + '</span>' +
+                        '<strong>' + t.actual.toFixed(2) + '</strong>' +
+                        '</div>';
+                }).join('') +
+                (run.events || []).map(function (change) {
+                    return '<div class="breakdown-row">' +
+                        '<span>🔧 ' + describeChange(change) + '</span>' +
+                        '<strong>' + change.t.toFixed(0) + 's</strong>' +
+                        '</div>';
+                }).join('');
+
+            const codes = Object.keys(s.status_codes || {}).sort().map(function (code) {
+                return '<div class="breakdown-row"><span class="code-badge code-' + code.charAt(0) + 'xx">' + code + '</span>' +
+                    '<strong>' + s.status_codes[code] + '</strong></div>';
+            }).concat(Object.keys(s.error_classes || {}).sort().map(function (cls) {
+                return '<div class="breakdown-row"><span>' + cls + '</span><strong>' + s.error_classes[cls] + '</strong></div>';
+            })).concat(Object.keys(s.assertion_failures || {}).sort().map(function (kind) {
+                return '<div class="breakdown-row"><span>🔍 ' + kind + '</span><strong>' + s.assertion_failures[kind] + '</strong></div>';
+            }));
+            document.getElementById('run-codes').innerHTML = codes.length > 0 ?
+                codes.join('') : '<div class="breakdown-empty">Нет ответов</div>';
+
+            document.getElementById('run-endpoints').innerHTML =
+                '<table class="endpoint-table"><tr>' +
+                '<th>Эндпоинт</th><th>Доля</th><th>Запросов</th><th>Ошибок</th><th>Проверки</th><th>p50</th><th>p95</th><th>p99</th><th>p99 с поправкой</th><th>Ср. ответ</th><th>МБ/с</th>' +
+                '</tr>' +
+                (s.per_endpoint || []).map(function (e) {
+                    return endpointRow(e, '') + (e.steps || []).map(function (step, i) {
+                        return endpointRow(step, 'step-row', (i + 1) + '. ');
+                    }).join('');
+                }).join('') +
+                '</table>';
+
+            const phasesSection = document.getElementById('run-phases-section');
+            phasesSection.style.display = s.phases ? 'block' : 'none';
+            if (s.phases) {
+                document.getElementById('run-phases').innerHTML = renderPhases(s.phases);
+            }
+
+            const timeline = run.timeline || [];
+            document.getElementById('run-timeline').innerHTML = timeline.length === 0 ?
+                '<div class="breakdown-empty">Нет данных</div>' :
+                '<table class="endpoint-table"><tr>' +
+                '<th>Секунда</th><th>RPS (цель)</th><th>RPS (факт)</th><th>Ошибок</th><th>В полёте</th><th>p50</th><th>p95</th><th>p99</th>' +
+                '</tr>' +
+                timeline.map(function (p) {
+                    return '<tr>' +
+                        '<td>' + p.t.toFixed(0) + '</td>' +
+                        '<td>' + p.target_rps + '</td>' +
+                        '<td>' + p.achieved_rps + '</td>' +
+                        '<td>' + p.errors + '</td>' +
+                        '<td>' + p.in_flight + '</td>' +
+                        '<td>' + p.p50_ms.toFixed(1) + ' мс</td>' +
+                        '<td>' + p.p95_ms.toFixed(1) + ' мс</td>' +
+                        '<td>' + p.p99_ms.toFixed(1) + ' мс</td>' +
+                        '</tr>';
+                }).join('') +
+                '</table>';
+
+            const baseline = document.getElementById('run-baseline');
+            if (run.comparison) {
+                renderComparison(run.comparison, baseline);
+            } else {
+                baseline.innerHTML = '<div class="breakdown-empty">Для этой нагрузки эталонный запуск не выбран</div>';
+            }
+
+            document.getElementById('run-details').style.display = 'block';
+            const charts = document.getElementById('run-charts');
+            charts.innerHTML = '';
+            if (timeline.length > 0) {
+                renderCharts(charts, timeline, run.events);
+            }
+        }
+
+        document.addEventListener('DOMContentLoaded', loadRuns);
+    </script>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>📚 История запусков</h1>
+            <p><a href="/">← Вернуться к тестированию</a></p>
+        </div>
+        <div class="content">
+            <div class="control-section">
+                <h3>🗂️ Сохранённые запуски</h3>
+                <div class="runs-toolbar">
+                    <button onclick="compareSelected()">⚖️ Сравнить выбранные</button>
+                </div>
+                <div id="runs"></div>
+            </div>
+            <div id="comparison-section" class="control-section" style="display: none;">
+                <h3>⚖️ Сравнение запусков</h3>
+                <div id="comparison"></div>
+            </div>
+            <div class="control-section thresholds-section">
+                <h3>🎯 Пороги регрессии относительно эталона</h3>
+                <div class="thresholds-grid">
+                    <div class="form-group">
+                        <label for="th-p95">Рост p95, %:</label>
+                        <input type="number" id="th-p95" min="0">
+                    </div>
+                    <div class="form-group">
+                        <label for="th-p99">Рост p99, %:</label>
+                        <input type="number" id="th-p99" min="0">
+                    </div>
+                    <div class="form-group">
+                        <label for="th-errors">Рост ошибок, п.п.:</label>
+                        <input type="number" id="th-errors" min="0" step="0.1">
+                    </div>
+                    <div class="form-group">
+                        <label for="th-rps">Падение RPS, %:</label>
+                        <input type="number" id="th-rps" min="0">
+                    </div>
+                </div>
+                <small style="color: #6c757d; margin-bottom: 10px; display: block;">0 — проверка отключена</small>
+                <div class="runs-toolbar">
+                    <button onclick="saveThresholds()">💾 Сохранить пороги</button>
+                </div>
+            </div>
+            <div id="run-details" style="display: none;">
+                <div class="control-section">
+                    <h3 id="run-title"></h3>
+                    <div id="run-summary"></div>
+                </div>
+                <div class="control-section breakdown-panel-wide">
+                    <h3>📌 Сравнение с эталоном</h3>
+                    <div id="run-baseline"></div>
+                </div>
+                <div class="breakdown-panel">
+                    <div class="control-section">
+                        <h3>📨 Коды ответа и ошибки</h3>
+                        <div id="run-codes"></div>
+                    </div>
+                    <div class="control-section">
+                        <h3>📍 По эндпоинтам</h3>
+                        <div id="run-endpoints"></div>
+                    </div>
+                </div>
+                <div id="run-phases-section" class="control-section breakdown-panel-wide">
+                    <h3>🔬 Фазы запроса</h3>
+                    <div id="run-phases"></div>
+                </div>
+                <div class="control-section breakdown-panel-wide">
+                    <h3>📊 Графики</h3>
+                    <div id="run-charts" class="chart-grid"></div>
+                </div>
+                <div class="control-section breakdown-panel-wide">
+                    <h3>🕒 По секундам</h3>
+                    <div id="run-timeline" class="timeline-wrap"></div>
+                </div>
+            </div>
+        </div>
+    </div>
+</body>
+</html>`
+
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	page := strings.Replace(historyHTML, "STYLES_PLACEHOLDER", pageStyles, 1)
+	page = strings.Replace(page, "CHARTS_SCRIPT_PLACEHOLDER", chartScript, 1)
+	w.Write([]byte(page))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a compiled JSONPath subset: $, .key, ['key'], [n] and the
+// wildcards .* and [*]. Nothing fancier is needed to pick ids out of API
+// responses.
+type jsonPath []jsonPathSegment
+
+type jsonPathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func compileJSONPath(expr string) (jsonPath, error) {
+	rest := strings.TrimSpace(expr)
+	if !strings.HasPrefix(rest, "$") {
+		return nil, fmt.Errorf("JSONPath %q must start with $", expr)
+	}
+	rest = rest[1:]
+
+	var path jsonPath
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".*"):
+			path = append(path, jsonPathSegment{wildcard: true})
+			rest = rest[2:]
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("JSONPath %q: empty key", expr)
+			}
+			path = append(path, jsonPathSegment{key: key})
+			rest = rest[end+1:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSONPath %q: missing ]", expr)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+
+			if inner == "*" {
+				path = append(path, jsonPathSegment{wildcard: true})
+				continue
+			}
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				path = append(path, jsonPathSegment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			n, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("JSONPath %q: bad index %q", expr, inner)
+			}
+			path = append(path, jsonPathSegment{index: n, isIndex: true})
+		default:
+			return nil, fmt.Errorf("JSONPath %q: unexpected %q", expr, rest)
+		}
+	}
+	return path, nil
+}
+
+// find returns every value in doc the path matches.
+func (p jsonPath) find(doc interface{}) []interface{} {
+	current := []interface{}{doc}
+	for _, seg := range p {
+		var next []interface{}
+		for _, v := range current {
+			switch node := v.(type) {
+			case map[string]interface{}:
+				if seg.wildcard {
+					for _, child := range node {
+						next = append(next, child)
+					}
+				} else if child, ok := node[seg.key]; ok && !seg.isIndex {
+					next = append(next, child)
+				}
+			case []interface{}:
+				switch {
+				case seg.wildcard:
+					next = append(next, node...)
+				case seg.isIndex:
+					i := seg.index
+					if i < 0 {
+						i += len(node)
+					}
+					if i >= 0 && i < len(node) {
+						next = append(next, node[i])
+					}
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// jsonString renders a decoded JSON value the way it would be written in a
+// template or compared against one: strings bare, everything else as JSON.
+func jsonString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case nil:
+		return "null"
+	default:
+		b, _ := json.Marshal(value)
+		return string(b)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const jsonPathDoc = `{
+	"id": 7,
+	"name": "Барсик",
+	"dotted.key": "yes",
+	"animals": [
+		{"id": 1, "tags": ["a", "b"]},
+		{"id": 2, "tags": []},
+		{"id": 3, "tags": ["c"]}
+	],
+	"owner": {"name": "Анна", "phone": null}
+}`
+
+func findAll(t *testing.T, expr string) []interface{} {
+	t.Helper()
+	var doc interface{}
+	if err := json.Unmarshal([]byte(jsonPathDoc), &doc); err != nil {
+		t.Fatal(err)
+	}
+	path, err := compileJSONPath(expr)
+	if err != nil {
+		t.Fatalf("compileJSONPath(%q): %v", expr, err)
+	}
+	return path.find(doc)
+}
+
+func TestJSONPathKeys(t *testing.T) {
+	if got := findAll(t, "$.id"); !reflect.DeepEqual(got, []interface{}{7.0}) {
+		t.Errorf("$.id: %v", got)
+	}
+	if got := findAll(t, " $.name "); !reflect.DeepEqual(got, []interface{}{"Барсик"}) {
+		t.Errorf("$.name: %v", got)
+	}
+	if got := findAll(t, "$['dotted.key']"); !reflect.DeepEqual(got, []interface{}{"yes"}) {
+		t.Errorf("quoted key: %v", got)
+	}
+	if got := findAll(t, `$["owner"].name`); !reflect.DeepEqual(got, []interface{}{"Анна"}) {
+		t.Errorf("double-quoted key: %v", got)
+	}
+	if got := findAll(t, "$.owner.phone"); !reflect.DeepEqual(got, []interface{}{nil}) {
+		t.Errorf("null value must still match: %v", got)
+	}
+	if got := findAll(t, "$"); len(got) != 1 {
+		t.Errorf("$ matched %d values", len(got))
+	}
+}
+
+func TestJSONPathIndexes(t *testing.T) {
+	for expr, want := range map[string]interface{}{
+		"$.animals[0].id":  1.0,
+		"$.animals[2].id":  3.0,
+		"$.animals[-1].id": 3.0,
+		"$.animals[-3].id": 1.0,
+	} {
+		if got := findAll(t, expr); !reflect.DeepEqual(got, []interface{}{want}) {
+			t.Errorf("%s: %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestJSONPathWildcards(t *testing.T) {
+	ids := []interface{}{1.0, 2.0, 3.0}
+	if got := findAll(t, "$.animals[*].id"); !reflect.DeepEqual(got, ids) {
+		t.Errorf("[*]: %v", got)
+	}
+	if got := findAll(t, "$.animals.*.id"); !reflect.DeepEqual(got, ids) {
+		t.Errorf(".*: %v", got)
+	}
+	if got := findAll(t, "$.animals[*].tags[*]"); !reflect.DeepEqual(got, []interface{}{"a", "b", "c"}) {
+		t.Errorf("nested wildcards: %v", got)
+	}
+	if got := findAll(t, "$.animals[*].tags[0]"); !reflect.DeepEqual(got, []interface{}{"a", "c"}) {
+		t.Errorf("index under wildcard: %v", got)
+	}
+	// Object members come in map order.
+	if got := findAll(t, "$.owner.*"); len(got) != 2 {
+		t.Errorf("object wildcard: %v", got)
+	}
+}
+
+func TestJSONPathNoMatch(t *testing.T) {
+	for _, expr := range []string{
+		"$.missing",
+		"$.id.deeper",
+		"$.animals.id",
+		"$.animals[3].id",
+		"$.animals[-4].id",
+		"$.owner[0]",
+	} {
+		if got := findAll(t, expr); len(got) != 0 {
+			t.Errorf("%s matched %v", expr, got)
+		}
+	}
+}
+
+func TestCompileJSONPathErrors(t *testing.T) {
+	for _, expr := range []string{"", "id", "$.", "$..id", "$[0", "$[x]", "$['a'", "$id"} {
+		if _, err := compileJSONPath(expr); err == nil {
+			t.Errorf("compileJSONPath(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestJSONString(t *testing.T) {
+	for want, value := range map[string]interface{}{
+		"text":      "text",
+		"42":        42.0,
+		"0.5":       0.5,
+		"true":      true,
+		"null":      nil,
+		`[1,"a"]`:   []interface{}{1.0, "a"},
+		`{"id":1}`:  map[string]interface{}{"id": 1.0},
+		`"quoted"`:  `"quoted"`,
+		"Барсик":    "Барсик",
+		"123456789": 123456789.0,
+	} {
+		if got := jsonString(value); got != want {
+			t.Errorf("jsonString(%#v) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestExtractor(t *testing.T) {
+	resp := &responseData{
+		Header: http.Header{"Location": {"/api/animals/42"}},
+		Body:   []byte(`{"id": 42, "name": "Барсик"}`),
+	}
+	extract := func(e Extractor) (string, *assertionError) {
+		t.Helper()
+		if err := e.compile(); err != nil {
+			t.Fatal(err)
+		}
+		return e.extract(resp)
+	}
+
+	if v, err := extract(Extractor{Var: "id", Expr: "$.id"}); err != nil || v != "42" {
+		t.Errorf("json: %q, %v", v, err)
+	}
+	if v, err := extract(Extractor{Var: "id", From: extractRegex, Expr: `"id": (\d+)`}); err != nil || v != "42" {
+		t.Errorf("regex group: %q, %v", v, err)
+	}
+	if v, err := extract(Extractor{Var: "name", From: extractRegex, Expr: `Бар[а-я]+`}); err != nil || v != "Барсик" {
+		t.Errorf("regex match: %q, %v", v, err)
+	}
+	if v, err := extract(Extractor{Var: "loc", From: extractHeader, Expr: "location"}); err != nil || v != "/api/animals/42" {
+		t.Errorf("header: %q, %v", v, err)
+	}
+	if _, err := extract(Extractor{Var: "x", Expr: "$.missing"}); err == nil || err.kind != assertExtraction {
+		t.Errorf("missing value: %v", err)
+	}
+
+	for _, bad := range []Extractor{
+		{Expr: "$.id"},
+		{Var: "x", From: "cookie", Expr: "sid"},
+		{Var: "x", From: extractHeader},
+		{Var: "x", From: extractRegex, Expr: "("},
+	} {
+		if err := bad.compile(); err == nil {
+			t.Errorf("%+v compiled", bad)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// jsonSchema is a compiled JSON Schema, limited to the keywords that describe
+// the shape of API responses: type, enum, const, properties, required,
+// additionalProperties, items, the numeric, string and array bounds, pattern
+// and the allOf/anyOf/oneOf/not combinators. Other keywords, $ref included,
+// are ignored.
+type jsonSchema struct {
+	always     *bool
+	types      []string
+	enum       []interface{}
+	constValue interface{}
+	hasConst   bool
+
+	properties           map[string]*jsonSchema
+	required             []string
+	additionalProperties *jsonSchema
+
+	items              *jsonSchema
+	minItems, maxItems *int
+
+	minimum, maximum                   *float64
+	exclusiveMinimum, exclusiveMaximum *float64
+
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+
+	allOf, anyOf, oneOf []*jsonSchema
+	not                 *jsonSchema
+}
+
+func compileJSONSchema(raw json.RawMessage) (*jsonSchema, error) {
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("JSON schema: %w", err)
+	}
+	return newJSONSchema(doc, "#")
+}
+
+func newJSONSchema(doc interface{}, at string) (*jsonSchema, error) {
+	s := &jsonSchema{}
+	if b, ok := doc.(bool); ok {
+		s.always = &b
+		return s, nil
+	}
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("JSON schema %s must be an object or a boolean", at)
+	}
+
+	sub := func(key string) (*jsonSchema, error) {
+		v, ok := m[key]
+		if !ok {
+			return nil, nil
+		}
+		return newJSONSchema(v, at+"/"+key)
+	}
+	list := func(key string) ([]*jsonSchema, error) {
+		v, ok := m[key]
+		if !ok {
+			return nil, nil
+		}
+		items, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("JSON schema %s/%s must be an array", at, key)
+		}
+		result := make([]*jsonSchema, len(items))
+		for i, item := range items {
+			schema, err := newJSONSchema(item, at+"/"+key+"/"+strconv.Itoa(i))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = schema
+		}
+		return result, nil
+	}
+	number := func(key string) *float64 {
+		if v, ok := m[key].(float64); ok {
+			return &v
+		}
+		return nil
+	}
+	count := func(key string) *int {
+		if v, ok := m[key].(float64); ok {
+			n := int(v)
+			return &n
+		}
+		return nil
+	}
+
+	switch t := m["type"].(type) {
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, v := range t {
+			if name, ok := v.(string); ok {
+				s.types = append(s.types, name)
+			}
+		}
+	}
+	if enum, ok := m["enum"].([]interface{}); ok {
+		s.enum = enum
+	}
+	s.constValue, s.hasConst = m["const"]
+
+	if props, ok := m["properties"].(map[string]interface{}); ok {
+		s.properties = make(map[string]*jsonSchema, len(props))
+		for name, v := range props {
+			schema, err := newJSONSchema(v, at+"/properties/"+name)
+			if err != nil {
+				return nil, err
+			}
+			s.properties[name] = schema
+		}
+	}
+	if required, ok := m["required"].([]interface{}); ok {
+		for _, v := range required {
+			if name, ok := v.(string); ok {
+				s.required = append(s.required, name)
+			}
+		}
+	}
+
+	var err error
+	if s.additionalProperties, err = sub("additionalProperties"); err != nil {
+		return nil, err
+	}
+	if s.items, err = sub("items"); err != nil {
+		return nil, err
+	}
+	if s.not, err = sub("not"); err != nil {
+		return nil, err
+	}
+	if s.allOf, err = list("allOf"); err != nil {
+		return nil, err
+	}
+	if s.anyOf, err = list("anyOf"); err != nil {
+		return nil, err
+	}
+	if s.oneOf, err = list("oneOf"); err != nil {
+		return nil, err
+	}
+
+	s.minItems, s.maxItems = count("minItems"), count("maxItems")
+	s.minLength, s.maxLength = count("minLength"), count("maxLength")
+	s.minimum, s.maximum = number("minimum"), number("maximum")
+	s.exclusiveMinimum, s.exclusiveMaximum = number("exclusiveMinimum"), number("exclusiveMaximum")
+
+	if pattern, ok := m["pattern"].(string); ok {
+		if s.pattern, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("JSON schema %s/pattern: %w", at, err)
+		}
+	}
+	return s, nil
+}
+
+// validate returns the first violation of the schema in v, with the JSONPath
+// of the offending value.
+func (s *jsonSchema) validate(v interface{}, path string) error {
+	if s.always != nil {
+		if !*s.always {
+			return fmt.Errorf("%s is not allowed", path)
+		}
+		return nil
+	}
+
+	if len(s.types) > 0 {
+		ok := false
+		for _, t := range s.types {
+			if jsonTypeMatches(t, v) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%s is %s, expected %v", path, jsonTypeOf(v), s.types)
+		}
+	}
+	if s.enum != nil {
+		ok := false
+		for _, e := range s.enum {
+			if reflect.DeepEqual(e, v) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%s = %s is not one of the allowed values", path, jsonString(v))
+		}
+	}
+	if s.hasConst && !reflect.DeepEqual(s.constValue, v) {
+		return fmt.Errorf("%s = %s, expected %s", path, jsonString(v), jsonString(s.constValue))
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if err := s.validateObject(value, path); err != nil {
+			return err
+		}
+	case []interface{}:
+		if s.minItems != nil && len(value) < *s.minItems {
+			return fmt.Errorf("%s has %d items, expected at least %d", path, len(value), *s.minItems)
+		}
+		if s.maxItems != nil && len(value) > *s.maxItems {
+			return fmt.Errorf("%s has %d items, expected at most %d", path, len(value), *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range value {
+				if err := s.items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case float64:
+		switch {
+		case s.minimum != nil && value < *s.minimum,
+			s.exclusiveMinimum != nil && value <= *s.exclusiveMinimum,
+			s.maximum != nil && value > *s.maximum,
+			s.exclusiveMaximum != nil && value >= *s.exclusiveMaximum:
+			return fmt.Errorf("%s = %g is out of range", path, value)
+		}
+	case string:
+		n := utf8.RuneCountInString(value)
+		if (s.minLength != nil && n < *s.minLength) || (s.maxLength != nil && n > *s.maxLength) {
+			return fmt.Errorf("%s has length %d, out of range", path, n)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(value) {
+			return fmt.Errorf("%s = %q does not match %s", path, value, s.pattern)
+		}
+	}
+
+	for _, sub := range s.allOf {
+		if err := sub.validate(v, path); err != nil {
+			return err
+		}
+	}
+	if len(s.anyOf) > 0 {
+		var firstErr error
+		for _, sub := range s.anyOf {
+			err := sub.validate(v, path)
+			if err == nil {
+				firstErr = nil
+				break
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if firstErr != nil {
+			return fmt.Errorf("%s matches none of anyOf: %w", path, firstErr)
+		}
+	}
+	if len(s.oneOf) > 0 {
+		matched := 0
+		for _, sub := range s.oneOf {
+			if sub.validate(v, path) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return fmt.Errorf("%s matches %d of oneOf, expected exactly 1", path, matched)
+		}
+	}
+	if s.not != nil && s.not.validate(v, path) == nil {
+		return fmt.Errorf("%s matches a schema it must not", path)
+	}
+	return nil
+}
+
+func (s *jsonSchema) validateObject(obj map[string]interface{}, path string) error {
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			return fmt.Errorf("%s.%s is required", path, name)
+		}
+	}
+
+	// Validate in key order, so the same response always reports the same
+	// violation.
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if prop, ok := s.properties[k]; ok {
+			if err := prop.validate(obj[k], path+"."+k); err != nil {
+				return err
+			}
+		} else if s.additionalProperties != nil {
+			if err := s.additionalProperties.validate(obj[k], path+"."+k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func jsonTypeMatches(t string, v interface{}) bool {
+	if t == "integer" {
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	}
+	return jsonTypeOf(v) == t
+}
+
+func jsonTypeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		valid  bool
+	}{
+		{"true schema", `true`, `{"a": 1}`, true},
+		{"false schema", `false`, `1`, false},
+
+		{"integer accepts whole number", `{"type": "integer"}`, `3`, true},
+		{"integer accepts whole float", `{"type": "integer"}`, `3.0`, true},
+		{"integer rejects fraction", `{"type": "integer"}`, `3.5`, false},
+		{"number accepts fraction", `{"type": "number"}`, `3.5`, true},
+		{"number accepts integer", `{"type": "number"}`, `3`, true},
+		{"number rejects string", `{"type": "number"}`, `"3"`, false},
+		{"type list", `{"type": ["string", "null"]}`, `null`, true},
+		{"type list mismatch", `{"type": ["string", "null"]}`, `1`, false},
+		{"boolean", `{"type": "boolean"}`, `false`, true},
+
+		{"enum match", `{"enum": ["кот", "собака"]}`, `"кот"`, true},
+		{"enum miss", `{"enum": ["кот", "собака"]}`, `"хомяк"`, false},
+		{"const", `{"const": {"a": [1]}}`, `{"a": [1]}`, true},
+		{"const mismatch", `{"const": 1}`, `2`, false},
+
+		{"required present", `{"type": "object", "required": ["id", "name"]}`, `{"id": 1, "name": "x"}`, true},
+		{"required missing", `{"type": "object", "required": ["id", "name"]}`, `{"id": 1}`, false},
+		{"required null counts", `{"required": ["id"]}`, `{"id": null}`, true},
+		{"property type", `{"properties": {"age": {"type": "integer"}}}`, `{"age": "old"}`, false},
+		{"absent property", `{"properties": {"age": {"type": "integer"}}}`, `{}`, true},
+		{"additional allowed", `{"properties": {"a": {}}}`, `{"b": 1}`, true},
+		{"additional forbidden", `{"properties": {"a": {}}, "additionalProperties": false}`, `{"b": 1}`, false},
+		{"additional schema", `{"additionalProperties": {"type": "string"}}`, `{"b": "x"}`, true},
+
+		{"items", `{"type": "array", "items": {"type": "integer"}}`, `[1, 2, 3]`, true},
+		{"items mismatch", `{"type": "array", "items": {"type": "integer"}}`, `[1, "2"]`, false},
+		{"min items", `{"minItems": 2}`, `[1]`, false},
+		{"max items", `{"maxItems": 1}`, `[1, 2]`, false},
+
+		{"minimum", `{"minimum": 1}`, `1`, true},
+		{"below minimum", `{"minimum": 1}`, `0.5`, false},
+		{"exclusive minimum", `{"exclusiveMinimum": 1}`, `1`, false},
+		{"maximum", `{"maximum": 10}`, `11`, false},
+		{"exclusive maximum", `{"exclusiveMaximum": 10}`, `9.9`, true},
+		{"min length counts runes", `{"minLength": 3}`, `"кот"`, true},
+		{"max length", `{"maxLength": 2}`, `"кот"`, false},
+		{"pattern", `{"pattern": "^[0-9]+$"}`, `"123"`, true},
+		{"pattern mismatch", `{"pattern": "^[0-9]+$"}`, `"12a"`, false},
+
+		{"allOf", `{"allOf": [{"type": "integer"}, {"minimum": 5}]}`, `7`, true},
+		{"allOf one fails", `{"allOf": [{"type": "integer"}, {"minimum": 5}]}`, `3`, false},
+		{"anyOf first", `{"anyOf": [{"type": "string"}, {"type": "integer"}]}`, `"a"`, true},
+		{"anyOf second", `{"anyOf": [{"type": "string"}, {"type": "integer"}]}`, `1`, true},
+		{"anyOf none", `{"anyOf": [{"type": "string"}, {"type": "integer"}]}`, `1.5`, false},
+		{"oneOf exactly one", `{"oneOf": [{"type": "integer"}, {"type": "string"}]}`, `1`, true},
+		{"oneOf two match", `{"oneOf": [{"type": "integer"}, {"type": "number"}]}`, `1`, false},
+		{"oneOf none match", `{"oneOf": [{"type": "integer"}, {"type": "string"}]}`, `true`, false},
+		{"not", `{"not": {"type": "null"}}`, `1`, true},
+		{"not matching", `{"not": {"type": "null"}}`, `null`, false},
+
+		{"nested", `{
+			"type": "array",
+			"items": {
+				"type": "object",
+				"required": ["id"],
+				"properties": {"id": {"type": "integer", "minimum": 1}, "tags": {"type": "array", "items": {"type": "string"}}}
+			}
+		}`, `[{"id": 1, "tags": ["a"]}, {"id": 2, "tags": [3]}]`, false},
+	}
+
+	for _, tt := range tests {
+		schema, err := compileJSONSchema(json.RawMessage(tt.schema))
+		if err != nil {
+			t.Errorf("%s: compile: %v", tt.name, err)
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		err = schema.validate(value, "$")
+		if tt.valid && err != nil {
+			t.Errorf("%s: %s rejected: %v", tt.name, tt.value, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: %s accepted", tt.name, tt.value)
+		}
+	}
+}
+
+func TestJSONSchemaViolationPath(t *testing.T) {
+	schema, err := compileJSONSchema(json.RawMessage(`{"items": {"properties": {"age": {"type": "integer"}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value interface{}
+	json.Unmarshal([]byte(`[{"age": 1}, {"age": "x"}]`), &value)
+
+	err = schema.validate(value, "$")
+	if err == nil || err.Error() != "$[1].age is string, expected [integer]" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestCompileJSONSchemaErrors(t *testing.T) {
+	for _, raw := range []string{
+		`not json`,
+		`1`,
+		`{"allOf": {}}`,
+		`{"properties": {"a": 1}}`,
+		`{"pattern": "("}`,
+	} {
+		if _, err := compileJSONSchema(json.RawMessage(raw)); err == nil {
+			t.Errorf("compileJSONSchema(%s) succeeded, expected an error", raw)
+		}
+	}
+}
@@ -5,12 +5,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"html"
+	"io"
 	"log"
-	"math"
-	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -18,11 +20,19 @@ import (
 )
 
 type EndpointConfig struct {
-	Name        string `json:"name"`
-	Method      string `json:"method"`
-	Path        string `json:"path"`
-	Description string `json:"description"`
-	NeedsBody   bool   `json:"needs_body"`
+	Name        string            `json:"name"`
+	Method      string            `json:"method"`
+	Path        string            `json:"path"`
+	Description string            `json:"description"`
+	NeedsBody   bool              `json:"needs_body"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Query       map[string]string `json:"query,omitempty"`
+	Body        string            `json:"body,omitempty"`
+	Assert      *Assertions       `json:"assert,omitempty"`
+	Custom      bool              `json:"custom"`
+
+	templates *endpointTemplates
+	scenario  *Scenario
 }
 
 type LoadProfile struct {
@@ -32,28 +42,93 @@ type LoadProfile struct {
 }
 
 type AppState struct {
-	Running     bool             `json:"running"`
-	RPS         int              `json:"rps"`
-	CurrentRPS  int              `json:"current_rps"`
-	Endpoint    string           `json:"endpoint"`
-	Profile     string           `json:"profile"`
-	TotalReqs   int64            `json:"total_requests"`
-	SuccessReqs int64            `json:"success_requests"`
-	ErrorReqs   int64            `json:"error_requests"`
-	StartTime   time.Time        `json:"start_time"`
-	Endpoints   []EndpointConfig `json:"endpoints"`
-	Profiles    []LoadProfile    `json:"profiles"`
+	RunID      string `json:"run_id,omitempty"`
+	Running    bool   `json:"running"`
+	RPS        int    `json:"rps"`
+	CurrentRPS int    `json:"current_rps"`
+	// AchievedRPS is what a virtual users run produced over the last
+	// second; such runs have no target RPS.
+	AchievedRPS   int               `json:"achieved_rps"`
+	Endpoint      string            `json:"endpoint"`
+	Mix           []MixEntry        `json:"mix"`
+	Replay        *ReplayConfig     `json:"replay,omitempty"`
+	Users         int               `json:"users,omitempty"`
+	MaxUsers      int               `json:"max_users,omitempty"`
+	Profile       string            `json:"profile"`
+	ProfileParams ProfileParams     `json:"profile_params"`
+	DurationSec   float64           `json:"duration_sec,omitempty"`
+	MaxRequests   int64             `json:"max_requests,omitempty"`
+	TotalReqs     int64             `json:"total_requests"`
+	SuccessReqs   int64             `json:"success_requests"`
+	ErrorReqs     int64             `json:"error_requests"`
+	StatusCodes   map[string]int64  `json:"status_codes"`
+	ErrorClasses  map[string]int64  `json:"error_classes"`
+	Assertions    map[string]int64  `json:"assertion_failures"`
+	StartTime     time.Time         `json:"start_time"`
+	Latency       LatencyStats      `json:"latency"`
+	Corrected     LatencyStats      `json:"corrected_latency"`
+	Pacing        PacingStats       `json:"pacing"`
+	Connections   ConnectionStats   `json:"connections"`
+	Phases        PhaseStats        `json:"phases"`
+	Traffic       TrafficStats      `json:"traffic"`
+	PerEndpoint   []EndpointStats   `json:"per_endpoint"`
+	Thresholds    []ThresholdResult `json:"thresholds,omitempty"`
+	Events        []TimelineEvent   `json:"events,omitempty"`
+	Summary       *RunSummary       `json:"summary,omitempty"`
+	Endpoints     []EndpointConfig  `json:"endpoints,omitempty"`
+	Profiles      []LoadProfile     `json:"profiles,omitempty"`
+}
+
+type requestBuilder func(ctx context.Context, baseURL string) (*http.Request, error)
+
+type requestSource interface {
+	next() (EndpointConfig, requestBuilder, bool)
+}
+
+type requestResult struct {
+	StatusCode int
+	Err        error
+	ErrorClass string
+	Assertion  string
+	Duration   time.Duration
+	BytesSent  int64
+	BytesRecv  int64
+	BodyHash   string
+	// Corrected is the latency corrected for coordinated omission: from
+	// when the request was scheduled to be sent rather than when it actually
+	// was, so time spent waiting behind a stalled target is not hidden.
+	Corrected time.Duration
+}
+
+// truncated fails a request whose body was needed but cut off at
+// maxResponseBody. That is a limit of the tester rather than a wrong
+// response, so it is an error class, not a failed assertion.
+func (res *requestResult) truncated() {
+	res.Err = errBodyTruncated
+	res.ErrorClass = errorClassBodyTruncated
+}
+
+func (res *requestResult) fail(err *assertionError) {
+	res.Err = err
+	res.Assertion = err.kind
 }
 
 var endpoints = []EndpointConfig{
 	{Name: "Главная страница", Method: "GET", Path: "/", Description: "Главная страница приюта", NeedsBody: false},
 	{Name: "Список животных", Method: "GET", Path: "/animals", Description: "Получить список всех животных", NeedsBody: false},
-	{Name: "Добавить животное", Method: "POST", Path: "/api/animals", Description: "Добавить новое животное", NeedsBody: true},
+	{Name: "Добавить животное", Method: "POST", Path: "/api/animals", Description: "Добавить новое животное", NeedsBody: true, Body: randomAnimalBody},
 	{Name: "Метрики", Method: "GET", Path: "/metrics", Description: "Метрики Prometheus", NeedsBody: false},
 	{Name: "Документация", Method: "GET", Path: "/docs", Description: "Документация API", NeedsBody: false},
 	{Name: "Замедлялка", Method: "GET", Path: "/slow", Description: "Замедлялка", NeedsBody: false},
 }
 
+const randomAnimalBody = `{` +
+	`"name": "{{pick "Барсик" "Шарик" "Мурзик" "Рекс" "Пушок" "Тузик" "Васька" "Жучка"}}", ` +
+	`"type": "{{pick "кот" "собака" "хомяк" "попугай" "черепаха"}}", ` +
+	`"age": {{randInt 1 15}}, ` +
+	`"health": "{{pick "здоров" "на лечении" "реабилитация" "карантин"}}"` +
+	`}`
+
 var profiles = []LoadProfile{
 	{Name: "Постоянная нагрузка", Description: "Стабильный RPS на протяжении всего теста", Type: "constant"},
 	{Name: "Постепенное нарастание", Description: "Плавное увеличение RPS от 1 до заданного значения", Type: "ramp_up"},
@@ -61,6 +136,7 @@ var profiles = []LoadProfile{
 	{Name: "Волнообразная нагрузка", Description: "Циклические колебания RPS (синусоида)", Type: "wave"},
 	{Name: "Ступенчатая нагрузка", Description: "Пошаговое увеличение нагрузки каждые 30 секунд", Type: "step"},
 	{Name: "Стресс-тест", Description: "Экстремальная нагрузка с случайными всплесками", Type: "stress"},
+	{Name: "Пользовательский", Description: "Последовательность этапов с заданной длительностью и RPS", Type: "custom"},
 }
 
 type LoadTester struct {
@@ -71,6 +147,35 @@ type LoadTester struct {
 	cancel    context.CancelFunc
 	isRunning int32
 	wg        sync.WaitGroup
+	latency   *Histogram
+	corrected *Histogram
+	inFlight  int64
+	scheduled int64
+	sent      int64
+	dropped   int64
+	omitted   []omittedArrival
+	sendLag   *Histogram
+	slots     chan struct{}
+	client    *runClient
+
+	bytesSent     int64
+	bytesReceived int64
+
+	config        RunConfig
+	source        requestSource
+	endpointStats map[string]*endpointCounters
+	window        *Histogram
+	timeline      sampleRing
+	lastRecord    *RunRecord
+
+	targetIntegral float64
+	targetSince    time.Time
+
+	// profileStart is when the current profile began: the run start, or the
+	// last time PATCH /run switched profiles. adjusted wakes the run loop
+	// after such a change.
+	profileStart time.Time
+	adjusted     chan struct{}
 }
 
 var (
@@ -78,13 +183,7 @@ var (
 	testerMutex sync.Mutex
 )
 
-const indexHTML = `<!DOCTYPE html>
-<html lang="ru">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Нагрузочное тестирование Приюта для животных</title>
-    <style>
+const pageStyles = `
         body {
             font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
             margin: 0;
@@ -106,6 +205,9 @@ const indexHTML = `<!DOCTYPE html>
             padding: 30px;
             text-align: center;
         }
+        .header a {
+            color: white;
+        }
         .header h1 {
             margin: 0;
             font-size: 2.5em;
@@ -149,7 +251,21 @@ const indexHTML = `<!DOCTYPE html>
             font-size: 16px;
             transition: border-color 0.3s;
         }
-        select:focus, input[type="number"]:focus {
+        textarea {
+            width: 100%;
+            box-sizing: border-box;
+            padding: 12px;
+            border: 2px solid #ced4da;
+            border-radius: 6px;
+            font-family: monospace;
+            font-size: 14px;
+        }
+        .param-row {
+            display: grid;
+            grid-template-columns: 1fr 1fr;
+            gap: 10px;
+        }
+        select:focus, input[type="number"]:focus, textarea:focus {
             outline: none;
             border-color: #667eea;
         }
@@ -168,6 +284,15 @@ const indexHTML = `<!DOCTYPE html>
             cursor: pointer;
             transition: all 0.3s;
         }
+        .client-settings {
+            margin-bottom: 15px;
+        }
+        .client-settings summary {
+            cursor: pointer;
+            font-weight: 600;
+            color: #495057;
+            margin-bottom: 10px;
+        }
         .toggle-btn {
             background: linear-gradient(135deg, #00d2ff, #3a7bd5);
             color: white;
@@ -184,7 +309,15 @@ const indexHTML = `<!DOCTYPE html>
         .toggle-btn.running:hover {
             box-shadow: 0 5px 15px rgba(255, 107, 107, 0.4);
         }
-        .toggle-btn:disabled {
+        .apply-btn {
+            background: linear-gradient(135deg, #a18cd1, #6f42c1);
+            color: white;
+        }
+        .apply-btn:hover {
+            transform: translateY(-2px);
+            box-shadow: 0 5px 15px rgba(111, 66, 193, 0.4);
+        }
+        .toggle-btn:disabled, .apply-btn:disabled {
             opacity: 0.6;
             cursor: not-allowed;
             transform: none;
@@ -235,26 +368,256 @@ const indexHTML = `<!DOCTYPE html>
         .method-GET { background: #28a745; }
         .method-POST { background: #007bff; }
         .method-PUT { background: #ffc107; color: #212529; }
+        .method-PATCH { background: #fd7e14; }
         .method-DELETE { background: #dc3545; }
-    </style>
+        .method-HEAD, .method-OPTIONS { background: #6c757d; }
+        .method-SCENARIO { background: #6f42c1; }
+        .mix-row {
+            display: grid;
+            grid-template-columns: 1fr 90px 44px;
+            gap: 8px;
+            margin-bottom: 8px;
+        }
+        .mix-row .remove-btn, .add-btn {
+            flex: none;
+            padding: 8px;
+            background: #e9ecef;
+            color: #495057;
+        }
+        .add-btn {
+            width: 100%;
+        }
+        .add-btn + .add-btn {
+            margin-top: 8px;
+        }
+        .mix-info-row + .mix-info-row {
+            margin-top: 8px;
+        }
+        .endpoint-table {
+            width: 100%;
+            border-collapse: collapse;
+        }
+        .endpoint-table th, .endpoint-table td {
+            padding: 8px;
+            text-align: right;
+            border-bottom: 1px solid #e9ecef;
+        }
+        .endpoint-table th:first-child, .endpoint-table td:first-child {
+            text-align: left;
+        }
+        .endpoint-table tr.step-row td {
+            color: #6c757d;
+            font-size: 13px;
+        }
+        .endpoint-table tr.step-row td:first-child {
+            padding-left: 30px;
+        }
+        .latency-grid {
+            grid-template-columns: repeat(auto-fit, minmax(110px, 1fr));
+            gap: 15px;
+        }
+        .latency-grid .status-value {
+            font-size: 1.4em;
+        }
+        .breakdown-panel {
+            display: grid;
+            grid-template-columns: repeat(auto-fit, minmax(220px, 1fr));
+            gap: 30px;
+            margin-top: 30px;
+        }
+        .summary-section {
+            margin-top: 30px;
+        }
+        .summary-meta {
+            color: #6c757d;
+            margin-bottom: 15px;
+        }
+        .breakdown-panel-wide {
+            margin-top: 30px;
+        }
+        .chart-grid {
+            display: grid;
+            grid-template-columns: repeat(auto-fit, minmax(300px, 1fr));
+            gap: 20px;
+        }
+        .chart-title {
+            font-weight: bold;
+            margin-bottom: 8px;
+        }
+        .chart {
+            width: 100%;
+            height: 180px;
+        }
+        .chart-legend {
+            font-size: 12px;
+            color: #6c757d;
+        }
+        .chart-legend span {
+            margin-right: 12px;
+        }
+        .chart-legend i {
+            display: inline-block;
+            width: 10px;
+            height: 10px;
+            border-radius: 2px;
+            margin-right: 4px;
+        }
+        .breakdown-row {
+            display: flex;
+            justify-content: space-between;
+            padding: 8px 0;
+            border-bottom: 1px solid #e9ecef;
+        }
+        .breakdown-empty {
+            color: #6c757d;
+        }
+        .code-badge {
+            display: inline-block;
+            padding: 2px 8px;
+            border-radius: 4px;
+            font-weight: bold;
+            color: white;
+        }
+        .code-2xx { background: #28a745; }
+        .code-3xx { background: #17a2b8; }
+        .code-4xx { background: #ffc107; color: #212529; }
+        .code-5xx { background: #dc3545; }
+        .threshold-ok { background: #28a745; }
+        .threshold-failed { background: #dc3545; }
+`
+
+const indexHTML = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Нагрузочное тестирование Приюта для животных</title>
+    <style>STYLES_PLACEHOLDER    </style>
     <script>
         let updateInterval;
+        let eventSource;
+        let timeline = { runID: null, samples: [], events: [] };
+        let lastStatus = null;
+
+        // chartWindowSec is how much of a run the live charts show.
+        const chartWindowSec = 300;
+CHARTS_SCRIPT_PLACEHOLDER
+        function drawLiveCharts() {
+            const samples = timeline.samples;
+            const from = samples.length > 0 ? samples[samples.length - 1].t - chartWindowSec : 0;
+            renderCharts(document.getElementById('charts'), samples.filter(function (p) { return p.t >= from; }), timeline.events);
+        }
+
+        async function loadTimeline() {
+            try {
+                const response = await fetch('/timeline');
+                const data = await response.json();
+                timeline = { runID: data.run_id, samples: data.samples || [], events: data.events || [] };
+                drawLiveCharts();
+            } catch (error) {
+                console.error('Ошибка загрузки графиков:', error);
+            }
+        }
+
+        function addSample(sample) {
+            if (sample.run_id !== timeline.runID) {
+                timeline = { runID: sample.run_id, samples: [], events: [] };
+            }
+            const last = timeline.samples[timeline.samples.length - 1];
+            if (last && sample.t <= last.t) return;
+            timeline.samples.push(sample);
+            drawLiveCharts();
+        }
         let endpoints = ENDPOINTS_JSON_PLACEHOLDER;
         let profiles = PROFILES_JSON_PLACEHOLDER;
 
-        function updateEndpointInfo() {
-            const select = document.getElementById('endpoint');
-            const selectedPath = select.value;
-            const endpoint = endpoints.find(ep => ep.path === selectedPath);
-            
-            if (endpoint) {
-                document.getElementById('endpoint-info').innerHTML =
-                    '<span class="method-badge method-' + endpoint.method + '">' + endpoint.method + '</span>' +
-                    '<strong>' + endpoint.path + '</strong><br>' +
-                    '<small>' + endpoint.description + '</small>';
+        function getMix() {
+            return Array.from(document.querySelectorAll('#mix-rows .mix-row')).map(function (row) {
+                const key = row.querySelector('.mix-endpoint').value;
+                const sep = key.indexOf(' ');
+                return {
+                    method: key.substring(0, sep),
+                    endpoint: key.substring(sep + 1),
+                    weight: parseFloat(row.querySelector('.mix-weight').value) || 0
+                };
+            });
+        }
+
+        function addMixRow() {
+            const template = document.getElementById('mix-row-template');
+            document.getElementById('mix-rows').appendChild(template.content.firstElementChild.cloneNode(true));
+            updateEndpointInfo();
+        }
+
+        function removeMixRow(button) {
+            if (document.querySelectorAll('#mix-rows .mix-row').length <= 1) return;
+            button.parentElement.remove();
+            updateEndpointInfo();
+        }
+
+        async function importFromSpec(button) {
+            button.disabled = true;
+            try {
+                const response = await fetch('/endpoints/import', { method: 'POST' });
+                if (!response.ok) {
+                    alert('Ошибка: ' + await response.text());
+                    return;
+                }
+                const result = await response.json();
+                result.imported.forEach(addEndpointOption);
+                updateEndpointInfo();
+                alert('Импортировано эндпоинтов: ' + result.imported.length +
+                    (result.skipped ? ', пропущено: ' + result.skipped.map(function (op) {
+                        return op.method + ' ' + op.path + ' (' + op.reason + ')';
+                    }).join(', ') : ''));
+            } catch (error) {
+                alert('Ошибка подключения: ' + error.message);
+            } finally {
+                button.disabled = false;
             }
         }
 
+        function addEndpointOption(ep) {
+            const key = ep.method + ' ' + ep.path;
+            endpoints = endpoints.filter(e => e.method + ' ' + e.path !== key);
+            endpoints.push(ep);
+
+            const template = document.getElementById('mix-row-template').content.querySelector('.mix-endpoint');
+            [template].concat(Array.from(document.querySelectorAll('#mix-rows .mix-endpoint'))).forEach(function (select) {
+                let option = Array.from(select.options).find(o => o.value === key);
+                if (!option) {
+                    option = document.createElement('option');
+                    option.value = key;
+                    select.insertBefore(option, select.querySelector('optgroup'));
+                }
+                option.textContent = ep.name;
+            });
+        }
+
+        function updateEndpointInfo() {
+            const mix = getMix();
+            const total = mix.reduce(function (sum, entry) { return sum + entry.weight; }, 0);
+
+            const info = document.getElementById('endpoint-info');
+            info.replaceChildren();
+            mix.forEach(function (entry) {
+                const endpoint = endpoints.find(ep => ep.method === entry.method && ep.path === entry.endpoint);
+                const share = total > 0 ? (entry.weight / total * 100).toFixed(0) : 0;
+
+                const row = document.createElement('div');
+                row.className = 'mix-info-row';
+                const badge = document.createElement('span');
+                badge.className = 'method-badge method-' + entry.method;
+                badge.textContent = entry.method;
+                const path = document.createElement('strong');
+                path.textContent = entry.endpoint;
+                const description = document.createElement('small');
+                description.textContent = endpoint ? endpoint.description : '';
+                row.append(badge, path, ' — ' + share + '%', document.createElement('br'), description);
+                info.appendChild(row);
+            });
+        }
+
         function updateProfileInfo() {
             const select = document.getElementById('profile');
             const selectedType = select.value;
@@ -269,6 +632,7 @@ const indexHTML = `<!DOCTYPE html>
                     case 'wave': profileIcon = '🌊'; break;
                     case 'step': profileIcon = '📶'; break;
                     case 'stress': profileIcon = '💥'; break;
+                    case 'custom': profileIcon = '🛠️'; break;
                 }
 
                 document.getElementById('profile-info').innerHTML =
@@ -276,6 +640,123 @@ const indexHTML = `<!DOCTYPE html>
                     '<strong>' + selectedType + '</strong><br>' +
                     '<small>' + profile.description + '</small>';
             }
+
+            document.querySelectorAll('.profile-param').forEach(function (group) {
+                const types = group.getAttribute('data-profiles').split(' ');
+                group.style.display = types.indexOf(selectedType) >= 0 ? 'block' : 'none';
+            });
+        }
+
+        function parseStages(text) {
+            return text.split('\n').map(function (line) {
+                return line.trim();
+            }).filter(function (line) {
+                return line.length > 0;
+            }).map(function (line) {
+                const parts = line.split(/\s+/);
+                return {
+                    duration_sec: parseFloat(parts[0]),
+                    rps: parseInt(parts[1]),
+                    transition: parts[2] || 'linear'
+                };
+            });
+        }
+
+        function getProfileParams(profile) {
+            const number = function (id) {
+                const value = parseFloat(document.getElementById(id).value);
+                return isNaN(value) ? undefined : value;
+            };
+
+            switch (profile) {
+                case 'ramp_up':
+                    return { ramp_duration_sec: number('ramp-duration') };
+                case 'spike':
+                    return { spike_delay_sec: number('spike-delay'), spike_hold_sec: number('spike-hold') };
+                case 'wave':
+                    return { wave_period_sec: number('wave-period'), wave_min_rps: number('wave-min') };
+                case 'step':
+                    return { step_duration_sec: number('step-duration'), step_count: number('step-count') };
+                case 'stress': {
+                    const chance = number('stress-chance');
+                    return { stress_burst_chance: chance === undefined ? undefined : chance / 100 };
+                }
+                case 'custom':
+                    return { stages: parseStages(document.getElementById('stages').value) };
+            }
+            return {};
+        }
+
+        function updateModel() {
+            const closed = document.getElementById('model').value === 'closed';
+            document.getElementById('rps-group').style.display = closed ? 'none' : 'block';
+            document.getElementById('arrival-group').style.display = closed ? 'none' : 'block';
+            document.getElementById('burst-group').style.display =
+                !closed && document.getElementById('arrival').value === 'bursty' ? 'grid' : 'none';
+            document.querySelectorAll('.users-param').forEach(function (group) {
+                group.style.display = closed ? 'block' : 'none';
+            });
+            const distribution = document.getElementById('think-distribution').value;
+            document.getElementById('think-mean-group').style.display = closed && distribution !== 'uniform' ? 'block' : 'none';
+            document.getElementById('think-range-group').style.display = closed && distribution === 'uniform' ? 'grid' : 'none';
+        }
+
+        function getArrival() {
+            const arrival = document.getElementById('arrival').value;
+            if (arrival !== 'bursty') {
+                return { arrival: arrival };
+            }
+            const burstOff = parseFloat(document.getElementById('burst-off').value);
+            return {
+                arrival: arrival,
+                burst_on_sec: parseFloat(document.getElementById('burst-on').value) || undefined,
+                burst_off_sec: isNaN(burstOff) ? undefined : burstOff
+            };
+        }
+
+        function getUsers() {
+            if (document.getElementById('model').value !== 'closed') {
+                return undefined;
+            }
+            const number = function (id) {
+                return parseFloat(document.getElementById(id).value) || 0;
+            };
+            return {
+                count: parseInt(document.getElementById('users').value) || 0,
+                think_time: {
+                    distribution: document.getElementById('think-distribution').value,
+                    mean_ms: number('think-mean'),
+                    min_ms: number('think-min'),
+                    max_ms: number('think-max')
+                }
+            };
+        }
+
+        function getThresholds() {
+            return document.getElementById('thresholds').value.split('\n').map(function (line) {
+                return line.trim();
+            }).filter(function (line) {
+                return line.length > 0;
+            }).map(function (line) {
+                return { expr: line };
+            });
+        }
+
+        function getClient() {
+            const number = function (id) {
+                return parseFloat(document.getElementById(id).value) || 0;
+            };
+            return {
+                disable_keep_alive: document.getElementById('keep-alive').value === 'off',
+                protocol: document.getElementById('protocol').value,
+                max_idle_conns_per_host: number('max-idle-conns'),
+                max_conns_per_host: number('max-conns'),
+                request_timeout_ms: number('request-timeout'),
+                dial_timeout_ms: number('dial-timeout'),
+                response_header_timeout_ms: number('header-timeout'),
+                max_redirects: number('max-redirects'),
+                disable_compression: !document.getElementById('compression').checked
+            };
         }
 
         async function toggleLoadTest() {
@@ -287,32 +768,58 @@ const indexHTML = `<!DOCTYPE html>
                 try {
                     const response = await fetch('/stop', { method: 'POST' });
                     updateStatus();
-                    stopStatusUpdates();
                 } catch (error) {
                     alert('Ошибка подключения: ' + error.message);
                 } finally {
                     button.disabled = false;
                 }
             } else {
-                const endpoint = document.getElementById('endpoint').value;
+                const mix = getMix();
                 const rps = document.getElementById('rps').value;
                 const profile = document.getElementById('profile').value;
+                const profileParams = Object.assign(getProfileParams(profile), getArrival());
+                const users = getUsers();
+
+                if (profile === 'custom' && profileParams.stages.some(function (stage) {
+                    return !(stage.duration_sec > 0) || !(stage.rps > 0);
+                })) {
+                    alert('Каждый этап должен быть в формате: длительность RPS [linear|instant]');
+                    button.disabled = false;
+                    return;
+                }
+
+                if (users && !(users.count > 0)) {
+                    alert('Пожалуйста, введите корректное число пользователей');
+                    button.disabled = false;
+                    return;
+                }
 
-                if (!rps || rps <= 0) {
+                if (!users && (!rps || rps <= 0)) {
                     alert('Пожалуйста, введите корректное значение RPS');
                     button.disabled = false;
                     return;
                 }
 
+                if (mix.some(function (entry) { return entry.weight <= 0; })) {
+                    alert('Доля каждого эндпоинта должна быть больше нуля');
+                    button.disabled = false;
+                    return;
+                }
+
                 try {
                     const response = await fetch('/start', {
                         method: 'POST',
                         headers: { 'Content-Type': 'application/json' },
-                        body: JSON.stringify({ endpoint: endpoint, rps: parseInt(rps), profile: profile })
+                        body: JSON.stringify({ endpoint: mix[0].endpoint, mix: mix, rps: parseInt(rps), users: users, profile: profile, profile_params: profileParams,
+                            duration_sec: parseFloat(document.getElementById('duration').value) || 0,
+                            max_requests: parseInt(document.getElementById('max-requests').value) || 0,
+                            thresholds: getThresholds(),
+                            client: getClient()
+                        })
                     });
 
                     if (response.ok) {
-                        startStatusUpdates();
+                        updateStatus();
                     } else {
                         const result = await response.text();
                         alert('Ошибка: ' + result);
@@ -325,83 +832,425 @@ const indexHTML = `<!DOCTYPE html>
             }
         }
 
+        // applyToRun changes the running test to the RPS or users, profile and
+        // endpoint mix currently in the form, without restarting it.
+        async function applyToRun() {
+            const button = document.getElementById('apply-btn');
+            const profile = document.getElementById('profile').value;
+            const patch = {
+                profile: profile,
+                profile_params: Object.assign(getProfileParams(profile), getArrival())
+            };
+            if (lastStatus && lastStatus.max_users) {
+                patch.users = parseInt(document.getElementById('users').value) || 0;
+            } else {
+                patch.rps = parseInt(document.getElementById('rps').value) || 0;
+            }
+            if (!lastStatus || !lastStatus.replay) {
+                patch.mix = getMix();
+            }
+
+            button.disabled = true;
+            try {
+                const response = await fetch('/run', {
+                    method: 'PATCH',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify(patch)
+                });
+                if (!response.ok) {
+                    alert('Ошибка: ' + await response.text());
+                }
+            } catch (error) {
+                alert('Ошибка подключения: ' + error.message);
+            } finally {
+                button.disabled = false;
+            }
+        }
+
         async function updateStatus() {
             try {
                 const response = await fetch('/status');
-                const status = await response.json();
-
-                const button = document.getElementById('toggle-btn');
-                if (button) {
-                    if (status.running) {
-                        button.classList.add('running');
-                        button.innerHTML = '⏹️ Остановить';
-                    } else {
-                        button.classList.remove('running');
-                        button.innerHTML = '▶️ Запустить';
-                    }
-                }
+                renderStatus(await response.json());
+            } catch (error) {
+                console.error('Ошибка обновления статуса:', error);
+            }
+        }
 
-                const statusDiv = document.getElementById('status');
-                const duration = status.running && status.start_time ?
-                    Math.floor((Date.now() - new Date(status.start_time).getTime()) / 1000) : 0;
+        function renderStatus(status) {
+            lastStatus = status;
+            document.getElementById('apply-btn').style.display = status.running ? 'block' : 'none';
 
-                const successRate = status.total_requests > 0 ?
-                    ((status.success_requests / status.total_requests) * 100).toFixed(1) : 0;
+            const button = document.getElementById('toggle-btn');
+            if (button) {
+                if (status.running) {
+                    button.classList.add('running');
+                    button.innerHTML = '⏹️ Остановить';
+                } else {
+                    button.classList.remove('running');
+                    button.innerHTML = '▶️ Запустить';
+                }
+            }
 
-                statusDiv.innerHTML =
-                    '<div class="status-item ' + (status.running ? 'running' : 'stopped') + '">' +
-                    '<div class="status-value">' + (status.running ? 'РАБОТАЕТ' : 'ОСТАНОВЛЕН') + '</div>' +
-                    '<div class="status-label">Статус</div>' +
-                    '</div>' +
+            const statusDiv = document.getElementById('status');
+            const duration = status.running && status.start_time ?
+                Math.floor((Date.now() - new Date(status.start_time).getTime()) / 1000) : 0;
+
+            const successRate = status.total_requests > 0 ?
+                ((status.success_requests / status.total_requests) * 100).toFixed(1) : 0;
+
+            statusDiv.innerHTML =
+                '<div class="status-item ' + (status.running ? 'running' : 'stopped') + '">' +
+                '<div class="status-value">' + (status.running ? 'РАБОТАЕТ' : 'ОСТАНОВЛЕН') + '</div>' +
+                '<div class="status-label">Статус</div>' +
+                '</div>' +
+                '<div class="status-item">' +
+                '<div class="status-value">' + (status.max_users ? status.achieved_rps : status.current_rps || status.rps) + '</div>' +
+                '<div class="status-label">' + (status.max_users ? 'RPS (факт)' : 'Текущий RPS') + '</div>' +
+                '</div>' +
+                (status.users ?
                     '<div class="status-item">' +
-                    '<div class="status-value">' + (status.current_rps || status.rps) + '</div>' +
-                    '<div class="status-label">Текущий RPS</div>' +
-                    '</div>' +
+                    '<div class="status-value">' + status.users + '</div>' +
+                    '<div class="status-label">Пользователей</div>' +
+                    '</div>' :
                     '<div class="status-item">' +
                     '<div class="status-value">' + status.rps + '</div>' +
                     '<div class="status-label">Макс. RPS</div>' +
-                    '</div>' +
-                    '<div class="status-item">' +
-                    '<div class="status-value">' + status.total_requests + '</div>' +
-                    '<div class="status-label">Всего запросов</div>' +
-                    '</div>' +
-                    '<div class="status-item">' +
-                    '<div class="status-value">' + status.success_requests + '</div>' +
-                    '<div class="status-label">Успешных</div>' +
-                    '</div>' +
-                    '<div class="status-item">' +
-                    '<div class="status-value">' + status.error_requests + '</div>' +
-                    '<div class="status-label">Ошибок</div>' +
-                    '</div>' +
-                    '<div class="status-item">' +
-                    '<div class="status-value">' + successRate + '%</div>' +
-                    '<div class="status-label">Успешность</div>' +
-                    '</div>' +
-                    '<div class="status-item">' +
-                    '<div class="status-value">' + duration + 's</div>' +
-                    '<div class="status-label">Время работы</div>' +
+                    '</div>') +
+                '<div class="status-item">' +
+                '<div class="status-value">' + status.total_requests + '</div>' +
+                '<div class="status-label">Всего запросов</div>' +
+                '</div>' +
+                '<div class="status-item">' +
+                '<div class="status-value">' + status.success_requests + '</div>' +
+                '<div class="status-label">Успешных</div>' +
+                '</div>' +
+                '<div class="status-item">' +
+                '<div class="status-value">' + status.error_requests + '</div>' +
+                '<div class="status-label">Ошибок</div>' +
+                '</div>' +
+                '<div class="status-item">' +
+                '<div class="status-value">' + successRate + '%</div>' +
+                '<div class="status-label">Успешность</div>' +
+                '</div>' +
+                '<div class="status-item">' +
+                '<div class="status-value">' + duration + 's</div>' +
+                '<div class="status-label">Время работы</div>' +
+                '</div>' +
+                '<div class="status-item">' +
+                '<div class="status-value">' + status.pacing.sent + ' / ' + status.pacing.scheduled + '</div>' +
+                '<div class="status-label">Отправлено / запланировано</div>' +
+                '</div>' +
+                '<div class="status-item">' +
+                '<div class="status-value">' + status.pacing.dropped + '</div>' +
+                '<div class="status-label">Отброшено</div>' +
+                '</div>' +
+                '<div class="status-item">' +
+                '<div class="status-value">' + status.pacing.send_lag.p99_ms.toFixed(2) + ' мс</div>' +
+                '<div class="status-label">Опоздание отправки p99</div>' +
+                '</div>' +
+                '<div class="status-item">' +
+                '<div class="status-value">' + status.connections.opened + ' / ' + status.connections.open + '</div>' +
+                '<div class="status-label">Соединений открыто / сейчас</div>' +
+                '</div>' +
+                '<div class="status-item">' +
+                '<div class="status-value">' + status.connections.reuse_pct.toFixed(1) + '%</div>' +
+                '<div class="status-label">Переиспользование соединений</div>' +
+                '</div>' +
+                '<div class="status-item">' +
+                '<div class="status-value">' + status.traffic.received_mb_per_sec.toFixed(2) + ' / ' + status.traffic.sent_mb_per_sec.toFixed(2) + '</div>' +
+                '<div class="status-label">МБ/с получено / отправлено</div>' +
+                '</div>' +
+                '<div class="status-item">' +
+                '<div class="status-value">' + formatBytes(status.traffic.avg_response_bytes) + '</div>' +
+                '<div class="status-label">Средний ответ</div>' +
+                '</div>';
+
+            updateLatency('latency', status.latency);
+            updateLatency('corrected-latency', status.corrected_latency);
+            document.getElementById('phases').innerHTML = renderPhases(status.phases);
+            updateBreakdown(status.status_codes, status.error_classes, status.assertion_failures);
+            updatePerEndpoint(status.per_endpoint);
+            updateThresholds(status.running || !status.summary ? status.thresholds : status.summary.thresholds);
+            updateSummary(status.running ? null : status.summary);
+        }
+
+        function updateLatency(id, latency) {
+            const items = [
+                ['p50', latency.p50_ms], ['p90', latency.p90_ms], ['p95', latency.p95_ms],
+                ['p99', latency.p99_ms], ['p99.9', latency.p999_ms], ['max', latency.max_ms],
+                ['Среднее', latency.mean_ms], ['Ст. откл.', latency.stddev_ms]
+            ];
+
+            document.getElementById(id).innerHTML = items.map(function (item) {
+                return '<div class="status-item">' +
+                    '<div class="status-value">' + item[1].toFixed(1) + ' мс</div>' +
+                    '<div class="status-label">' + item[0] + '</div>' +
                     '</div>';
-            } catch (error) {
-                console.error('Ошибка обновления статуса:', error);
+            }).join('');
+        }
+
+        const phaseNames = [
+            ['conn_wait', 'Ожидание соединения'], ['dns', 'DNS'], ['connect', 'TCP-соединение'], ['tls', 'TLS'],
+            ['ttfb', 'До первого байта'], ['transfer', 'Передача тела']
+        ];
+
+        function renderPhases(phases) {
+            return '<table class="endpoint-table"><tr>' +
+                '<th>Фаза</th><th>Запросов</th><th>p50</th><th>p95</th><th>p99</th><th>max</th>' +
+                '</tr>' +
+                phaseNames.filter(function (phase) {
+                    return phases[phase[0]];
+                }).map(function (phase) {
+                    const s = phases[phase[0]];
+                    return '<tr>' +
+                        '<td>' + phase[1] + '</td>' +
+                        '<td>' + s.count + '</td>' +
+                        '<td>' + s.p50_ms.toFixed(2) + ' мс</td>' +
+                        '<td>' + s.p95_ms.toFixed(2) + ' мс</td>' +
+                        '<td>' + s.p99_ms.toFixed(2) + ' мс</td>' +
+                        '<td>' + s.max_ms.toFixed(2) + ' мс</td>' +
+                        '</tr>';
+                }).join('') +
+                '</table>';
+        }
+
+        const errorClassNames = {
+            timeout: 'Таймаут',
+            connection_refused: 'Соединение отклонено',
+            connection_reset: 'Соединение сброшено',
+            dns: 'Ошибка DNS',
+            tls: 'Ошибка TLS',
+            context_cancelled: 'Отменён',
+            body_truncated: 'Тело ответа обрезано',
+            other: 'Прочие'
+        };
+
+        const assertionNames = {
+            status: 'Код ответа',
+            contains: 'Нет ожидаемого текста',
+            not_contains: 'Запрещённый текст',
+            jsonpath: 'JSONPath',
+            schema: 'JSON Schema',
+            body_size: 'Размер ответа',
+            duration: 'Время ответа',
+            extraction: 'Извлечение данных'
+        };
+
+        function renderCounts(counts, labelFn, emptyText) {
+            const keys = Object.keys(counts || {}).sort();
+            if (keys.length === 0) {
+                return '<div class="breakdown-empty">' + emptyText + '</div>';
             }
+            return keys.map(function (key) {
+                return '<div class="breakdown-row">' +
+                    '<span>' + labelFn(key) + '</span>' +
+                    '<strong>' + counts[key] + '</strong>' +
+                    '</div>';
+            }).join('');
         }
 
-        function startStatusUpdates() {
-            if (updateInterval) clearInterval(updateInterval);
-            updateInterval = setInterval(updateStatus, 1000);
+        function updateBreakdown(statusCodes, errorClasses, assertions) {
+            document.getElementById('status-codes').innerHTML = renderCounts(statusCodes, function (code) {
+                return '<span class="code-badge code-' + code.charAt(0) + 'xx">' + code + '</span>';
+            }, 'Нет ответов');
+            document.getElementById('error-classes').innerHTML = renderCounts(errorClasses, function (cls) {
+                return errorClassNames[cls] || cls;
+            }, 'Нет ошибок транспорта');
+            document.getElementById('assertion-failures').innerHTML = renderCounts(assertions, function (kind) {
+                return assertionNames[kind] || kind;
+            }, 'Все проверки пройдены');
+        }
+
+        function endpointRow(s, cls, prefix) {
+            return '<tr class="' + cls + '">' +
+                '<td>' + (prefix || '') + '<span class="method-badge method-' + s.method + '">' + s.method + '</span>' + escapeHTML(s.path) + '</td>' +
+                '<td>' + (cls ? '' : (s.share * 100).toFixed(0) + '%') + '</td>' +
+                '<td>' + s.total_requests + '</td>' +
+                '<td>' + s.error_requests + '</td>' +
+                '<td>' + s.assertion_failures + '</td>' +
+                '<td>' + s.latency.p50_ms.toFixed(1) + ' мс</td>' +
+                '<td>' + s.latency.p95_ms.toFixed(1) + ' мс</td>' +
+                '<td>' + s.latency.p99_ms.toFixed(1) + ' мс</td>' +
+                '<td>' + s.corrected_latency.p99_ms.toFixed(1) + ' мс</td>' +
+                '<td>' + (s.steps ? '' : formatBytes(s.traffic.avg_response_bytes) +
+                    (s.distinct_bodies ? ' (' + s.distinct_bodies + ' разных)' : '')) + '</td>' +
+                '<td>' + (s.steps ? '' : s.traffic.received_mb_per_sec.toFixed(2)) + '</td>' +
+                '</tr>';
+        }
+
+        function updatePerEndpoint(stats) {
+            if (!stats || stats.length === 0) {
+                document.getElementById('per-endpoint').innerHTML = '<div class="breakdown-empty">Нет данных</div>';
+                return;
+            }
+
+            document.getElementById('per-endpoint').innerHTML =
+                '<table class="endpoint-table"><tr>' +
+                '<th>Эндпоинт</th><th>Доля</th><th>Запросов</th><th>Ошибок</th><th>Проверки</th><th>p50</th><th>p95</th><th>p99</th><th>p99 с поправкой</th><th>Ср. ответ</th><th>МБ/с</th>' +
+                '</tr>' +
+                stats.map(function (s) {
+                    return endpointRow(s, '') + (s.steps || []).map(function (step, i) {
+                        return endpointRow(step, 'step-row', (i + 1) + '. ');
+                    }).join('');
+                }).join('') +
+                '</table>';
+        }
+
+        const stopReasonNames = {
+            manual: 'остановлен вручную',
+            duration: 'истекла длительность',
+            max_requests: 'достигнут лимит запросов',
+            source_exhausted: 'закончились запросы для воспроизведения',
+            shutdown: 'завершение работы',
+            threshold: 'нарушен порог SLO'
+        };
+
+        function updateThresholds(thresholds) {
+            const section = document.getElementById('thresholds-section');
+            if (!thresholds || thresholds.length === 0) {
+                section.style.display = 'none';
+                return;
+            }
+
+            section.style.display = 'block';
+            document.getElementById('threshold-results').innerHTML = thresholds.map(function (t) {
+                let note = t.passed ? 'выполнен' : 'нарушен';
+                if (t.aborted) {
+                    note = 'тест прерван';
+                } else if (!t.passed && t.breached_sec) {
+                    note += ' ' + t.breached_sec + ' с подряд';
+                }
+                return '<div class="breakdown-row">' +
+                    '<span>' + escapeHTML(t.expr) + '</span>' +
+                    '<span>' + t.actual.toFixed(2) + ' ' +
+                    '<span class="code-badge threshold-' + (t.passed ? 'ok' : 'failed') + '">' + note + '</span></span>' +
+                    '</div>';
+            }).join('');
+        }
+
+        function updateSummary(summary) {
+            const section = document.getElementById('summary-section');
+            if (!summary) {
+                section.style.display = 'none';
+                return;
+            }
+
+            section.style.display = 'block';
+            const items = [
+                ['Всего запросов', summary.total_requests],
+                ['Ошибок', summary.error_rate.toFixed(2) + '%'],
+                !summary.target_rps ? ['RPS (факт)', summary.achieved_rps.toFixed(1)] :
+                    ['RPS (факт / цель)', summary.achieved_rps.toFixed(1) + ' / ' + summary.target_rps.toFixed(1)],
+                ['p50', summary.latency.p50_ms.toFixed(1) + ' мс'],
+                ['p95', summary.latency.p95_ms.toFixed(1) + ' мс'],
+                ['p99', summary.latency.p99_ms.toFixed(1) + ' мс'],
+                ['p99 с поправкой', summary.corrected_latency.p99_ms.toFixed(1) + ' мс'],
+                ['Длительность', summary.duration_sec.toFixed(0) + 's'],
+                ['Отправлено / запланировано', summary.pacing.sent + ' / ' + summary.pacing.scheduled],
+                ['Отброшено', summary.pacing.dropped],
+                ['Соединений / переиспользование', summary.connections.opened + ' / ' + summary.connections.reuse_pct.toFixed(1) + '%'],
+                ['Получено / отправлено', formatBytes(summary.traffic.bytes_received) + ' / ' + formatBytes(summary.traffic.bytes_sent)],
+                ['МБ/с получено', summary.traffic.received_mb_per_sec.toFixed(2)]
+            ];
+            if (summary.thresholds) {
+                items.push(['Пороги SLO', summary.failed ? '❌ не пройдены' : '✅ пройдены']);
+            }
+
+            document.getElementById('summary').innerHTML =
+                '<div class="summary-meta">' +
+                new Date(summary.start_time).toLocaleString() + ' — ' + new Date(summary.end_time).toLocaleString() +
+                ' (' + (stopReasonNames[summary.stop_reason] || summary.stop_reason) + ')' +
+                '</div>' +
+                '<div class="status-grid latency-grid">' +
+                items.map(function (item) {
+                    return '<div class="status-item">' +
+                        '<div class="status-value">' + item[1] + '</div>' +
+                        '<div class="status-label">' + item[0] + '</div>' +
+                        '</div>';
+                }).join('') +
+                '</div>' +
+                (summary.users_curve ?
+                    '<table class="endpoint-table" style="margin-top: 15px;"><tr>' +
+                    '<th>Пользователей</th><th>Секунд</th><th>RPS (факт)</th><th>p50</th><th>p95</th>' +
+                    '</tr>' +
+                    summary.users_curve.map(function (p) {
+                        return '<tr>' +
+                            '<td>' + p.users + '</td>' +
+                            '<td>' + p.seconds + '</td>' +
+                            '<td>' + p.achieved_rps.toFixed(1) + '</td>' +
+                            '<td>' + p.p50_ms.toFixed(1) + ' мс</td>' +
+                            '<td>' + p.p95_ms.toFixed(1) + ' мс</td>' +
+                            '</tr>';
+                    }).join('') +
+                    '</table>' : '');
+        }
+
+        const eventNames = {
+            started: '▶️ Запуск',
+            stage_changed: '🪜 Новый этап',
+            threshold_breached: '🚨 Нарушен порог',
+            run_changed: '🔧 Изменение',
+            stopped: '⏹️ Остановка'
+        };
+
+        function describeEvent(type, data) {
+            switch (type) {
+                case 'started': return escapeHTML(data.description);
+                case 'stage_changed': return 'этап ' + (data.stage + 1) + ', ' + data.target_rps + ' RPS';
+                case 'threshold_breached': return escapeHTML(data.expr) + ' (' + data.actual.toFixed(2) + ')';
+                case 'run_changed': return describeChange(data);
+                case 'stopped': return stopReasonNames[data.reason] || data.reason;
+                default: return '';
+            }
+        }
+
+        function addEvent(type, data) {
+            const log = document.getElementById('event-log');
+            if (log.querySelector('.breakdown-empty')) log.innerHTML = '';
+
+            const row = document.createElement('div');
+            row.className = 'breakdown-row';
+            row.innerHTML = '<span>' + eventNames[type] + ' — ' + describeEvent(type, data) + '</span>' +
+                '<small>' + new Date().toLocaleTimeString() + '</small>';
+            log.insertBefore(row, log.firstChild);
+            while (log.children.length > 20) log.removeChild(log.lastChild);
         }
 
-        function stopStatusUpdates() {
-            if (updateInterval) {
-                clearInterval(updateInterval);
-                updateInterval = null;
+        // Status arrives over /events; polling /status is only a fallback
+        // for browsers without EventSource.
+        function startStatusUpdates() {
+            if (!window.EventSource) {
+                if (updateInterval) clearInterval(updateInterval);
+                updateInterval = setInterval(updateStatus, 1000);
+                return;
             }
+
+            eventSource = new EventSource('/events');
+            eventSource.addEventListener('snapshot', function (e) {
+                renderStatus(JSON.parse(e.data));
+            });
+            eventSource.addEventListener('sample', function (e) {
+                addSample(JSON.parse(e.data));
+            });
+            eventSource.addEventListener('run_changed', function (e) {
+                const change = JSON.parse(e.data);
+                if (change.run_id === timeline.runID) {
+                    timeline.events.push(change);
+                    drawLiveCharts();
+                }
+            });
+            Object.keys(eventNames).forEach(function (type) {
+                eventSource.addEventListener(type, function (e) {
+                    addEvent(type, JSON.parse(e.data));
+                });
+            });
         }
 
         document.addEventListener('DOMContentLoaded', function () {
-            updateEndpointInfo();
+            addMixRow();
             updateProfileInfo();
-            updateStatus();
+            updateModel();
+            loadTimeline();
             startStatusUpdates();
         });
     </script>
@@ -410,19 +1259,35 @@ const indexHTML = `<!DOCTYPE html>
     <div class="container">
         <div class="header">
             <h1>🐾 Нагрузочное тестирование Приюта для животных</h1>
-            <p>Инструмент для тестирования API приюта для животных</p>
+            <p>Инструмент для тестирования API приюта для животных · <a href="/history">История запусков</a></p>
         </div>
         <div class="content">
             <div class="control-panel">
                 <div class="control-section">
                     <h3>⚙️ Настройки тестирования</h3>
                     <div class="form-group">
-                        <label for="endpoint">Выберите эндпоинт:</label>
-                        <select id="endpoint" onchange="updateEndpointInfo()">
-                            ENDPOINTS_OPTIONS_PLACEHOLDER
-                        </select>
+                        <label>Эндпоинты и доли трафика:</label>
+                        <template id="mix-row-template">
+                            <div class="mix-row">
+                                <select class="mix-endpoint" onchange="updateEndpointInfo()">
+                                    ENDPOINTS_OPTIONS_PLACEHOLDER
+                                </select>
+                                <input type="number" class="mix-weight" min="1" value="100" oninput="updateEndpointInfo()">
+                                <button type="button" class="remove-btn" onclick="removeMixRow(this)">✖</button>
+                            </div>
+                        </template>
+                        <div id="mix-rows"></div>
+                        <button type="button" class="add-btn" onclick="addMixRow()">➕ Добавить эндпоинт</button>
+                        <button type="button" class="add-btn" onclick="importFromSpec(this)">📥 Импорт из Swagger</button>
                         <div id="endpoint-info" class="endpoint-info"></div>
                     </div>
+                    <div class="form-group">
+                        <label for="model">Модель нагрузки:</label>
+                        <select id="model" onchange="updateModel()">
+                            <option value="open">Открытая — заданный RPS</option>
+                            <option value="closed">Закрытая — виртуальные пользователи</option>
+                        </select>
+                    </div>
                     <div class="form-group">
                         <label for="profile">Профиль нагрузки:</label>
                         <select id="profile" onchange="updateProfileInfo()">
@@ -430,13 +1295,174 @@ const indexHTML = `<!DOCTYPE html>
                         </select>
                         <div id="profile-info" class="endpoint-info"></div>
                     </div>
-                    <div class="form-group">
+                    <div class="form-group profile-param" data-profiles="ramp_up">
+                        <label for="ramp-duration">Длительность нарастания, с:</label>
+                        <input type="number" id="ramp-duration" min="1" value="60">
+                    </div>
+                    <div class="form-group profile-param param-row" data-profiles="spike">
+                        <div>
+                            <label for="spike-delay">Задержка пика, с:</label>
+                            <input type="number" id="spike-delay" min="0" value="5">
+                        </div>
+                        <div>
+                            <label for="spike-hold">Удержание пика, с (0 — бесконечно):</label>
+                            <input type="number" id="spike-hold" min="0" value="0">
+                        </div>
+                    </div>
+                    <div class="form-group profile-param param-row" data-profiles="wave">
+                        <div>
+                            <label for="wave-period">Период волны, с:</label>
+                            <input type="number" id="wave-period" min="1" value="60">
+                        </div>
+                        <div>
+                            <label for="wave-min">Минимальный RPS:</label>
+                            <input type="number" id="wave-min" min="0" value="0">
+                        </div>
+                    </div>
+                    <div class="form-group profile-param param-row" data-profiles="step">
+                        <div>
+                            <label for="step-duration">Длительность ступени, с:</label>
+                            <input type="number" id="step-duration" min="1" value="30">
+                        </div>
+                        <div>
+                            <label for="step-count">Количество ступеней:</label>
+                            <input type="number" id="step-count" min="1" value="5">
+                        </div>
+                    </div>
+                    <div class="form-group profile-param" data-profiles="stress">
+                        <label for="stress-chance">Вероятность всплеска, %:</label>
+                        <input type="number" id="stress-chance" min="0" max="100" value="10">
+                    </div>
+                    <div class="form-group profile-param" data-profiles="custom">
+                        <label for="stages">Этапы (длительность в секундах, RPS, переход):</label>
+                        <textarea id="stages" rows="4">30 10 linear
+60 50 linear
+30 50 instant
+30 5 instant</textarea>
+                        <small style="color: #6c757d; margin-top: 5px; display: block;">Переход: linear — плавно, instant — сразу</small>
+                    </div>
+                    <div class="form-group" id="arrival-group">
+                        <label for="arrival">Распределение интервалов между запросами:</label>
+                        <select id="arrival" onchange="updateModel()">
+                            <option value="uniform">Равномерное — через равные промежутки</option>
+                            <option value="poisson">Пуассоновское — экспоненциальные интервалы</option>
+                            <option value="bursty">Пачками — чередование нагрузки и тишины</option>
+                        </select>
+                        <small style="color: #6c757d; margin-top: 5px; display: block;">Средний RPS сохраняется при любом распределении</small>
+                    </div>
+                    <div class="form-group param-row" id="burst-group">
+                        <div>
+                            <label for="burst-on">Пачка, с:</label>
+                            <input type="number" id="burst-on" min="0.1" step="0.1" value="1">
+                        </div>
+                        <div>
+                            <label for="burst-off">Пауза, с:</label>
+                            <input type="number" id="burst-off" min="0" step="0.1" value="2">
+                        </div>
+                    </div>
+                    <div class="form-group" id="rps-group">
                         <label for="rps">Максимальный RPS:</label>
-                        <input type="number" id="rps" min="1" max="1000" value="10">
+                        <input type="number" id="rps" min="1" max="20000" value="10">
                         <small style="color: #6c757d; margin-top: 5px; display: block;">Для некоторых профилей это максимальное значение</small>
                     </div>
+                    <div class="form-group users-param">
+                        <label for="users">Максимум виртуальных пользователей:</label>
+                        <input type="number" id="users" min="1" max="10000" value="10">
+                        <small style="color: #6c757d; margin-top: 5px; display: block;">Профиль нагрузки наращивает число пользователей, как RPS в открытой модели</small>
+                    </div>
+                    <div class="form-group users-param">
+                        <label for="think-distribution">Время на размышление:</label>
+                        <select id="think-distribution" onchange="updateModel()">
+                            <option value="fixed">Фиксированное</option>
+                            <option value="uniform">Равномерное</option>
+                            <option value="exponential">Экспоненциальное</option>
+                        </select>
+                    </div>
+                    <div class="form-group users-param" id="think-mean-group">
+                        <label for="think-mean">Время на размышление (среднее), мс:</label>
+                        <input type="number" id="think-mean" min="0" value="1000">
+                    </div>
+                    <div class="form-group users-param param-row" id="think-range-group">
+                        <div>
+                            <label for="think-min">От, мс:</label>
+                            <input type="number" id="think-min" min="0" value="500">
+                        </div>
+                        <div>
+                            <label for="think-max">До, мс:</label>
+                            <input type="number" id="think-max" min="0" value="2000">
+                        </div>
+                    </div>
+                    <div class="form-group param-row">
+                        <div>
+                            <label for="duration">Длительность, с:</label>
+                            <input type="number" id="duration" min="0" value="0">
+                        </div>
+                        <div>
+                            <label for="max-requests">Лимит запросов:</label>
+                            <input type="number" id="max-requests" min="0" value="0">
+                        </div>
+                    </div>
+                    <small style="color: #6c757d; margin-top: -10px; margin-bottom: 10px; display: block;">0 — без ограничения, тест остановится вручную</small>
+                    <div class="form-group">
+                        <label for="thresholds">Пороги SLO, по одному на строку:</label>
+                        <textarea id="thresholds" rows="3" placeholder="p95 < 300ms abort 10s&#10;error_rate < 1%&#10;achieved_rps >= 0.95 * target"></textarea>
+                        <small style="color: #6c757d; margin-top: 5px; display: block;">abort N — прервать тест, если порог нарушен N секунд подряд</small>
+                    </div>
+                    <details class="client-settings">
+                        <summary>🔌 HTTP-клиент</summary>
+                        <div class="form-group param-row">
+                            <div>
+                                <label for="keep-alive">Keep-alive:</label>
+                                <select id="keep-alive">
+                                    <option value="on">Включён (тёплый пул)</option>
+                                    <option value="off">Выключен (новое соединение на запрос)</option>
+                                </select>
+                            </div>
+                            <div>
+                                <label for="protocol">Протокол:</label>
+                                <select id="protocol">
+                                    <option value="http1">HTTP/1.1</option>
+                                    <option value="http2">HTTP/2 (только https)</option>
+                                </select>
+                            </div>
+                        </div>
+                        <div class="form-group param-row">
+                            <div>
+                                <label for="max-idle-conns">Простаивающих соединений:</label>
+                                <input type="number" id="max-idle-conns" min="0" value="100">
+                            </div>
+                            <div>
+                                <label for="max-conns">Макс. соединений (0 — без лимита):</label>
+                                <input type="number" id="max-conns" min="0" value="0">
+                            </div>
+                        </div>
+                        <div class="form-group param-row">
+                            <div>
+                                <label for="request-timeout">Таймаут запроса, мс:</label>
+                                <input type="number" id="request-timeout" min="0" value="5000">
+                            </div>
+                            <div>
+                                <label for="dial-timeout">Таймаут соединения, мс:</label>
+                                <input type="number" id="dial-timeout" min="0" value="5000">
+                            </div>
+                        </div>
+                        <div class="form-group param-row">
+                            <div>
+                                <label for="header-timeout">Таймаут заголовков, мс (0 — нет):</label>
+                                <input type="number" id="header-timeout" min="0" value="0">
+                            </div>
+                            <div>
+                                <label for="max-redirects">Редиректов (0 — не следовать):</label>
+                                <input type="number" id="max-redirects" min="0" value="10">
+                            </div>
+                        </div>
+                        <div class="form-group">
+                            <label><input type="checkbox" id="compression" checked> Запрашивать сжатие (gzip)</label>
+                        </div>
+                    </details>
                     <div class="buttons">
                         <button id="toggle-btn" class="toggle-btn" onclick="toggleLoadTest()">▶️ Запустить</button>
+                        <button id="apply-btn" class="apply-btn" onclick="applyToRun()" style="display: none;">🔄 Применить к запуску</button>
                     </div>
                 </div>
                 <div class="control-section">
@@ -446,32 +1472,95 @@ const indexHTML = `<!DOCTYPE html>
                     </div>
                 </div>
             </div>
+            <div class="control-section">
+                <h3>⏱️ Задержка ответа</h3>
+                <div id="latency" class="status-grid latency-grid">
+                    <!-- Перцентили задержки будут обновляться через JavaScript -->
+                </div>
+            </div>
+            <div class="control-section">
+                <h3>⏳ Задержка с поправкой на coordinated omission</h3>
+                <small style="color: #6c757d; margin-bottom: 10px; display: block;">От запланированного момента отправки, а не фактического: учитывает ожидание запросов, пока сервер не отвечал</small>
+                <div id="corrected-latency" class="status-grid latency-grid"></div>
+            </div>
+            <div class="control-section">
+                <h3>🔬 Фазы запроса</h3>
+                <small style="color: #6c757d; margin-bottom: 10px; display: block;">DNS, TCP и TLS — только для новых соединений; до первого байта — очередь и обработка на сервере</small>
+                <div id="phases"></div>
+            </div>
+            <div id="thresholds-section" class="control-section summary-section" style="display: none;">
+                <h3>🎯 Пороги SLO</h3>
+                <div id="threshold-results"></div>
+            </div>
+            <div id="summary-section" class="control-section summary-section" style="display: none;">
+                <h3>📋 Итоги последнего запуска</h3>
+                <div id="summary"></div>
+            </div>
+            <div class="breakdown-panel">
+                <div class="control-section">
+                    <h3>📨 Коды ответа</h3>
+                    <div id="status-codes"></div>
+                </div>
+                <div class="control-section">
+                    <h3>🔌 Ошибки транспорта</h3>
+                    <div id="error-classes"></div>
+                </div>
+                <div class="control-section">
+                    <h3>🔍 Проваленные проверки</h3>
+                    <div id="assertion-failures"></div>
+                </div>
+            </div>
+            <div class="control-section breakdown-panel-wide">
+                <h3>📊 Графики</h3>
+                <div id="charts" class="chart-grid"></div>
+            </div>
+            <div class="control-section breakdown-panel-wide">
+                <h3>📍 По эндпоинтам</h3>
+                <div id="per-endpoint"></div>
+            </div>
+            <div class="control-section breakdown-panel-wide">
+                <h3>📜 События</h3>
+                <div id="event-log"><div class="breakdown-empty">Событий пока нет</div></div>
+            </div>
         </div>
     </div>
 </body>
 </html>`
 
 func main() {
-	loadTester = &LoadTester{
-		state: AppState{
-			Running:    false,
-			RPS:        10,
-			CurrentRPS: 0,
-			Endpoint:   "/animals",
-			Profile:    "constant",
-			Endpoints:  endpoints,
-			Profiles:   profiles,
-		},
-		stopChan: make(chan struct{}),
+	if err := initEndpoints(); err != nil {
+		log.Fatalf("Failed to load endpoints: %v", err)
+	}
+	if err := initScenarios(); err != nil {
+		log.Fatalf("Failed to load scenarios: %v", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		os.Exit(runCLI(os.Args[2:]))
+	}
+
+	loadTester = newLoadTester()
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	http.HandleFunc("/", indexHandler)
 	http.HandleFunc("/start", startHandler)
 	http.HandleFunc("/stop", stopHandler)
+	http.HandleFunc("/run", runPatchHandler)
 	http.HandleFunc("/status", statusHandler)
+	http.HandleFunc("/events", eventsHandler)
+	http.HandleFunc("/timeline", timelineHandler)
+	http.HandleFunc("/metrics", metricsHandler)
+	http.HandleFunc("/endpoints", endpointsHandler)
+	http.HandleFunc("/endpoints/import", importEndpointsHandler)
+	http.HandleFunc("/scenarios", scenariosHandler)
+	http.HandleFunc("/replays", replaysHandler)
+	http.HandleFunc("/runs", runsHandler)
+	http.HandleFunc("/runs/", runHandler)
+	http.HandleFunc("/history", historyHandler)
+	http.HandleFunc("/compare", compareHandler)
+	http.HandleFunc("/baselines", baselinesHandler)
 
 	port := getEnv("PORT", "3006")
 	log.Printf("Starting Animal Shelter Load Tester on port %s", port)
@@ -486,19 +1575,56 @@ func main() {
 	log.Println("Shutting down...")
 	testerMutex.Lock()
 	if loadTester != nil && loadTester.state.Running {
-		loadTester.forceStop()
+		loadTester.stop(stopReasonShutdown)
 	}
 	testerMutex.Unlock()
 }
 
+func newLoadTester() *LoadTester {
+	return &LoadTester{
+		state: AppState{
+			Running:      false,
+			RPS:          10,
+			CurrentRPS:   0,
+			Endpoint:     "/animals",
+			Profile:      "constant",
+			StatusCodes:  make(map[string]int64),
+			ErrorClasses: make(map[string]int64),
+			Assertions:   make(map[string]int64),
+			Endpoints:    listEndpoints(),
+			Profiles:     profiles,
+		},
+		stopChan:  make(chan struct{}),
+		adjusted:  make(chan struct{}, 1),
+		latency:   NewHistogram(),
+		corrected: NewHistogram(),
+		window:    NewHistogram(),
+		sendLag:   NewHistogram(),
+	}
+}
+
 func indexHandler(w http.ResponseWriter, r *http.Request) {
-	endpointsJSON, _ := json.Marshal(endpoints)
+	currentEndpoints := listEndpoints()
 	profilesJSON, _ := json.Marshal(profiles)
 
 	endpointsOptions := ""
-	for _, ep := range endpoints {
-		endpointsOptions += fmt.Sprintf(`<option value="%s">%s</option>`, ep.Path, ep.Name)
+	for _, ep := range currentEndpoints {
+		endpointsOptions += fmt.Sprintf(`<option value="%s">%s</option>`, html.EscapeString(ep.Key()), html.EscapeString(ep.Name))
 	}
+	if list := listScenarios(); len(list) > 0 {
+		endpointsOptions += `<optgroup label="Сценарии">`
+		for _, sc := range list {
+			ep := sc.endpoint()
+			currentEndpoints = append(currentEndpoints, ep)
+			label := ep.Description
+			if label == "" {
+				label = sc.Name
+			}
+			endpointsOptions += fmt.Sprintf(`<option value="%s">%s (шагов: %d)</option>`, html.EscapeString(ep.Key()), html.EscapeString(label), len(sc.Steps))
+		}
+		endpointsOptions += `</optgroup>`
+	}
+	endpointsJSON, _ := json.Marshal(currentEndpoints)
 
 	profilesOptions := ""
 	for _, p := range profiles {
@@ -506,6 +1632,8 @@ func indexHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	htmlBytes := []byte(indexHTML)
+	htmlBytes = bytes.ReplaceAll(htmlBytes, []byte("STYLES_PLACEHOLDER"), []byte(pageStyles))
+	htmlBytes = bytes.ReplaceAll(htmlBytes, []byte("CHARTS_SCRIPT_PLACEHOLDER"), []byte(chartScript))
 	htmlBytes = bytes.ReplaceAll(htmlBytes, []byte("ENDPOINTS_JSON_PLACEHOLDER"), endpointsJSON)
 	htmlBytes = bytes.ReplaceAll(htmlBytes, []byte("PROFILES_JSON_PLACEHOLDER"), profilesJSON)
 	htmlBytes = bytes.ReplaceAll(htmlBytes, []byte("ENDPOINTS_OPTIONS_PLACEHOLDER"), []byte(endpointsOptions))
@@ -521,17 +1649,18 @@ func startHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Endpoint string `json:"endpoint"`
-		RPS      int    `json:"rps"`
-		Profile  string `json:"profile"`
-	}
-
+	var req RunConfig
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	plan, err := newRunPlan(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	testerMutex.Lock()
 	defer testerMutex.Unlock()
 
@@ -540,34 +1669,13 @@ func startHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.RPS <= 0 || req.RPS > 1000 {
-		http.Error(w, "RPS must be between 1 and 1000", http.StatusBadRequest)
-		return
-	}
-
-	loadTester.forceStop()
-	loadTester.ctx, loadTester.cancel = context.WithCancel(context.Background())
-
-	loadTester.mutex.Lock()
-	loadTester.state.RPS = req.RPS
-	loadTester.state.CurrentRPS = 1
-	loadTester.state.Endpoint = req.Endpoint
-	loadTester.state.Profile = req.Profile
-	loadTester.state.Running = true
-	loadTester.state.TotalReqs = 0
-	loadTester.state.SuccessReqs = 0
-	loadTester.state.ErrorReqs = 0
-	loadTester.state.StartTime = time.Now()
+	loadTester.start(req, plan)
 
-	if req.Profile == "constant" || req.Profile == "spike" {
-		loadTester.state.CurrentRPS = req.RPS
+	if plan.timedReplay {
+		fmt.Fprintf(w, "Started %s at %gx speed", plan.description, req.Replay.Speed)
+		return
 	}
-	loadTester.mutex.Unlock()
-
-	atomic.StoreInt32(&loadTester.isRunning, 1)
-	go loadTester.runLoadTest()
-
-	fmt.Fprintf(w, "Started load test for %s with %d RPS using %s profile", req.Endpoint, req.RPS, req.Profile)
+	fmt.Fprintf(w, "Started load test for %s with %d RPS using %s profile", plan.description, req.RPS, req.Profile)
 }
 
 func stopHandler(w http.ResponseWriter, r *http.Request) {
@@ -584,19 +1692,41 @@ func stopHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	loadTester.forceStop()
+	loadTester.stop(stopReasonManual)
 	fmt.Fprintf(w, "Stopped")
 }
 
 func statusHandler(w http.ResponseWriter, r *http.Request) {
-	loadTester.mutex.RLock()
-	data := loadTester.state
-	loadTester.mutex.RUnlock()
+	data := loadTester.snapshot()
+	data.Endpoints = listEndpoints()
+	data.Profiles = profiles
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
 }
 
+// snapshot copies the state of the current run, without the static endpoint
+// and profile lists.
+func (lt *LoadTester) snapshot() AppState {
+	lt.mutex.RLock()
+	data := lt.state
+	data.StatusCodes = copyCounts(lt.state.StatusCodes)
+	data.ErrorClasses = copyCounts(lt.state.ErrorClasses)
+	data.Assertions = copyCounts(lt.state.Assertions)
+	data.PerEndpoint = endpointStatsList(lt.endpointStats, lt.elapsedLocked())
+	data.Traffic = lt.trafficStatsLocked(lt.elapsedLocked())
+	data.Thresholds = append([]ThresholdResult(nil), lt.state.Thresholds...)
+	data.Connections = lt.client.stats()
+	data.Phases = lt.client.phaseStats()
+	lt.mutex.RUnlock()
+	data.Endpoints = nil
+	data.Profiles = nil
+	data.Latency = lt.latency.Stats()
+	data.Corrected = lt.corrected.Stats()
+	data.Pacing = lt.pacingStats()
+	return data
+}
+
 func (lt *LoadTester) forceStop() {
 	log.Println("🛑 Force stop initiated")
 	atomic.StoreInt32(&lt.isRunning, 0)
@@ -614,7 +1744,7 @@ func (lt *LoadTester) forceStop() {
 
 	lt.mutex.Lock()
 	lt.state.Running = false
-	lt.state.CurrentRPS = 0
+	lt.setCurrentRPSLocked(0)
 	lt.mutex.Unlock()
 
 	done := make(chan struct{})
@@ -631,234 +1761,439 @@ func (lt *LoadTester) forceStop() {
 	}
 }
 
+// stop ends the current run and freezes its final summary. testerMutex must
+// be held.
+func (lt *LoadTester) stop(reason string) {
+	endTime := time.Now()
+	lt.forceStop()
+
+	lt.mutex.Lock()
+	lt.flushOmittedLocked(endTime)
+	summary := lt.buildSummaryLocked(endTime, reason)
+	lt.state.Summary = summary
+	record := &RunRecord{
+		ID: lt.state.RunID, Config: lt.config, Summary: summary,
+		Timeline: lt.timeline.list(), Events: lt.state.Events,
+	}
+	lt.mutex.Unlock()
+	lt.client.close()
+
+	log.Printf("📋 Run finished (%s): %d requests, %.2f%% errors, p95 %.1fms, %.1f of %.1f target RPS",
+		reason, summary.TotalReqs, summary.ErrorRate, summary.Latency.P95, summary.AchievedRPS, summary.TargetRPS)
+
+	if record.Comparison = checkAgainstBaseline(record); record.Comparison != nil && record.Comparison.Regression {
+		log.Printf("🚨 Run %s regressed against baseline %s: %s",
+			record.ID, record.Comparison.BaseID, strings.Join(record.Comparison.Reasons, "; "))
+	}
+
+	if err := runs.save(record); err != nil {
+		log.Printf("⚠️ Failed to save run %s: %v", record.ID, err)
+	}
+	lt.lastRecord = record
+
+	events.publish(eventStopped, StoppedEvent{RunID: record.ID, Reason: reason, Summary: summary})
+	events.publish(eventSnapshot, lt.snapshot())
+}
+
+// runDeadline returns a channel that fires when the run's duration_sec is
+// over, or a nil channel when the run has no duration limit.
+func runDeadline(startTime time.Time, durationSec float64) (<-chan time.Time, func()) {
+	if durationSec <= 0 {
+		return nil, func() {}
+	}
+	timer := time.NewTimer(time.Until(startTime.Add(time.Duration(durationSec * float64(time.Second)))))
+	return timer.C, func() { timer.Stop() }
+}
+
 func (lt *LoadTester) runLoadTest() {
 	defer atomic.StoreInt32(&lt.isRunning, 0)
-	targetURL := getEnv("TARGET_URL", "http://localhost:8000")
+	ctx := lt.ctx
 
 	lt.mutex.RLock()
+	targetURL := lt.config.Target
 	currentRPS := lt.state.CurrentRPS
-	profile := lt.state.Profile
-	maxRPS := lt.state.RPS
+	maxRequests := lt.state.MaxRequests
+	startTime := lt.state.StartTime
+	params := lt.state.ProfileParams
+	deadline, stopDeadline := runDeadline(startTime, lt.state.DurationSec)
 	lt.mutex.RUnlock()
+	defer stopDeadline()
 
-	ticker := time.NewTicker(time.Second / time.Duration(currentRPS))
-	defer ticker.Stop()
-
-	profileStopChan := make(chan struct{})
-	defer close(profileStopChan)
-
-	go func() {
-		profileTicker := time.NewTicker(1 * time.Second)
-		defer profileTicker.Stop()
+	p := newPacer(startTime, currentRPS, params)
+	timer := time.NewTimer(p.wait(time.Now()))
+	defer timer.Stop()
 
-		for {
-			select {
-			case <-lt.ctx.Done():
-				return
-			case <-lt.stopChan:
-				return
-			case <-profileStopChan:
-				return
-			case <-profileTicker.C:
-				if atomic.LoadInt32(&lt.isRunning) == 0 {
-					return
-				}
-
-				newRPS := lt.calculateRPS(profile, maxRPS)
-				if newRPS != currentRPS && newRPS > 0 {
-					currentRPS = newRPS
-					ticker.Reset(time.Second / time.Duration(currentRPS))
-
-					lt.mutex.Lock()
-					lt.state.CurrentRPS = currentRPS
-					lt.mutex.Unlock()
-				}
-			}
-		}
-	}()
+	profileTicker := time.NewTicker(1 * time.Second)
+	defer profileTicker.Stop()
 
+	var sent int64
 	for {
 		select {
-		case <-lt.ctx.Done():
+		case <-ctx.Done():
 			return
 		case <-lt.stopChan:
 			return
-		case <-ticker.C:
-			if atomic.LoadInt32(&lt.isRunning) == 0 {
+		case <-deadline:
+			lt.finish(ctx, stopReasonDuration)
+			return
+		case <-profileTicker.C:
+			currentRPS = lt.retarget(p, timer, currentRPS)
+			continue
+		case <-lt.adjusted:
+			lt.mutex.RLock()
+			params := lt.state.ProfileParams
+			lt.mutex.RUnlock()
+
+			p.setArrival(params)
+			resetTimer(timer, p.wait(time.Now()))
+			currentRPS = lt.retarget(p, timer, currentRPS)
+			continue
+		case <-timer.C:
+		}
+
+		if atomic.LoadInt32(&lt.isRunning) == 0 {
+			return
+		}
+
+		lt.mutex.RLock()
+		source := lt.source
+		lt.mutex.RUnlock()
+
+		// Skipped arrivals were never given an endpoint, so they only count
+		// toward the corrected latency of the whole run.
+		now := time.Now()
+		for _, scheduled := range p.skipLagging(now) {
+			atomic.AddInt64(&lt.scheduled, 1)
+			atomic.AddInt64(&lt.dropped, 1)
+			lt.omit("", scheduled)
+		}
+
+		for batch := 0; batch < pacerMaxBatch && p.due(now); batch++ {
+			ep, build, ok := source.next()
+			if !ok {
+				log.Println("📼 Request source exhausted")
+				lt.finish(ctx, stopReasonExhausted)
 				return
 			}
 
-			lt.wg.Add(1)
-			go func() {
-				defer lt.wg.Done()
-
-				requestCtx, requestCancel := context.WithTimeout(lt.ctx, 5*time.Second)
-				defer requestCancel()
-
-				if atomic.LoadInt32(&lt.isRunning) == 0 {
-					return
-				}
-
-				lt.mutex.RLock()
-				endpoint := lt.state.Endpoint
-				running := lt.state.Running
-				lt.mutex.RUnlock()
-
-				if !running || atomic.LoadInt32(&lt.isRunning) == 0 {
-					return
-				}
-
-				err := makeRequestWithContext(requestCtx, targetURL+endpoint)
-
-				if atomic.LoadInt32(&lt.isRunning) == 0 {
-					return
-				}
-
-				lt.mutex.Lock()
-				if lt.state.Running && atomic.LoadInt32(&lt.isRunning) == 1 {
-					lt.state.TotalReqs++
-					if err != nil {
-						lt.state.ErrorReqs++
-					} else {
-						lt.state.SuccessReqs++
-					}
-				}
-				lt.mutex.Unlock()
-			}()
+			if !lt.dispatch(targetURL, ep, build, p.advance()) {
+				continue
+			}
+
+			sent++
+			if maxRequests > 0 && sent >= maxRequests {
+				lt.finish(ctx, stopReasonMaxRequests)
+				return
+			}
 		}
+
+		timer.Reset(p.wait(time.Now()))
 	}
 }
 
-func (lt *LoadTester) calculateRPS(profile string, maxRPS int) int {
+// retarget moves the pacer to the rate the profile asks for now and returns
+// it.
+func (lt *LoadTester) retarget(p *pacer, timer *time.Timer, currentRPS int) int {
+	newRPS := lt.profileTarget()
+	if newRPS == currentRPS || newRPS <= 0 {
+		return currentRPS
+	}
+	p.setRate(newRPS)
+	resetTimer(timer, p.wait(time.Now()))
+
+	lt.mutex.Lock()
+	lt.setCurrentRPSLocked(newRPS)
+	lt.mutex.Unlock()
+	return newRPS
+}
+
+// dispatch sends one request in its own goroutine. scheduled is when the
+// request was meant to be sent; it is dropped if the run already has
+// max_in_flight requests waiting for a response. It reports whether the
+// request was sent.
+func (lt *LoadTester) dispatch(targetURL string, ep EndpointConfig, build requestBuilder, scheduled time.Time) bool {
+	atomic.AddInt64(&lt.scheduled, 1)
+
 	lt.mutex.RLock()
-	startTime := lt.state.StartTime
+	slots := lt.slots
 	lt.mutex.RUnlock()
 
-	elapsed := time.Since(startTime).Seconds()
-
-	switch profile {
-	case "constant":
-		return maxRPS
-	case "ramp_up":
-		duration := 60.0
-		if elapsed >= duration {
-			return maxRPS
-		}
-		progress := elapsed / duration
-		return int(1 + float64(maxRPS-1)*progress)
-	case "spike":
-		if elapsed < 5 {
-			return 1
-		}
-		return maxRPS
-	case "wave":
-		period := 60.0
-		amplitude := float64(maxRPS) / 2
-		baseline := amplitude
-		wave := math.Sin(2 * math.Pi * elapsed / period)
-		return int(baseline + amplitude*wave)
-	case "step":
-		step := int(elapsed / 30)
-		stepSize := maxRPS / 5
-		if stepSize == 0 {
-			stepSize = 1
-		}
-		rps := (step + 1) * stepSize
-		if rps > maxRPS {
-			return maxRPS
-		}
-		return rps
-	case "stress":
-		baseRPS := maxRPS / 3
-		if rand.Float64() < 0.1 {
-			return maxRPS
-		}
-		variableRPS := baseRPS + rand.Intn(maxRPS/2)
-		if variableRPS > maxRPS {
-			return maxRPS
-		}
-		return variableRPS
+	select {
+	case slots <- struct{}{}:
 	default:
-		return maxRPS
+		atomic.AddInt64(&lt.dropped, 1)
+		lt.omit(ep.Key(), scheduled)
+		return false
 	}
+	atomic.AddInt64(&lt.sent, 1)
+	lt.sendLag.Record(time.Since(scheduled))
+
+	lt.wg.Add(1)
+	go func() {
+		defer lt.wg.Done()
+		defer func() { <-slots }()
+
+		lt.execute(targetURL, ep, build, scheduled)
+		lt.flushOmitted(time.Now())
+	}()
+	return true
 }
 
-func generateRandomAnimal() map[string]interface{} {
-	rand.Seed(time.Now().UnixNano())
+// execute sends one request, or runs one iteration of a scenario, and waits
+// for its response, then records the result if the run is still going.
+// scheduled is when the request was meant to be sent.
+func (lt *LoadTester) execute(targetURL string, ep EndpointConfig, build requestBuilder, scheduled time.Time) {
+	if atomic.LoadInt32(&lt.isRunning) == 0 {
+		return
+	}
 
-	animalTypes := []string{"кот", "собака", "хомяк", "попугай", "черепаха"}
-	healthStatuses := []string{"здоров", "на лечении", "реабилитация", "карантин"}
-	names := []string{"Барсик", "Шарик", "Мурзик", "Рекс", "Пушок", "Тузик", "Васька", "Жучка"}
+	lt.mutex.RLock()
+	running := lt.state.Running
+	lt.mutex.RUnlock()
 
-	return map[string]interface{}{
-		"name":   names[rand.Intn(len(names))],
-		"type":   animalTypes[rand.Intn(len(animalTypes))],
-		"age":    rand.Intn(15) + 1, // Возраст от 1 до 15 лет
-		"health": healthStatuses[rand.Intn(len(healthStatuses))],
+	if !running || atomic.LoadInt32(&lt.isRunning) == 0 {
+		return
 	}
-}
 
-func makeRequestWithContext(ctx context.Context, url string) error {
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
+	if ep.scenario != nil {
+		lt.runScenario(targetURL, ep, scheduled)
+		return
+	}
+
+	resp, res := lt.send(targetURL, build, ep.Assert.needsBody(), scheduled)
+	if atomic.LoadInt32(&lt.isRunning) == 0 {
+		return
 	}
 
-	loadTester.mutex.RLock()
-	endpoint := loadTester.state.Endpoint
-	loadTester.mutex.RUnlock()
+	ep.Assert.apply(resp, &res, nil)
+
+	lt.recordResult(ep, res)
+}
+
+// send makes one request, counting it as in flight while it is waiting for
+// the response. The body is only read if readBody is set. The corrected
+// latency is measured from scheduled, or from the actual send time when
+// scheduled is zero.
+func (lt *LoadTester) send(targetURL string, build requestBuilder, readBody bool, scheduled time.Time) (*responseData, requestResult) {
+	lt.mutex.RLock()
+	client := lt.client
+	lt.mutex.RUnlock()
+
+	requestCtx, requestCancel := context.WithTimeout(lt.ctx, client.timeout)
+	defer requestCancel()
 
-	var method string
-	var needsBody bool
-	for _, ep := range endpoints {
-		if ep.Path == endpoint {
-			method = ep.Method
-			needsBody = ep.NeedsBody
-			break
+	traceCtx, times := client.trace(requestCtx)
+
+	atomic.AddInt64(&lt.inFlight, 1)
+	requestStart := time.Now()
+	var sent int64
+	resp, err := makeRequestWithContext(traceCtx, client, targetURL, func(ctx context.Context, baseURL string) (*http.Request, error) {
+		req, err := build(ctx, baseURL)
+		if req != nil && req.ContentLength > 0 {
+			sent = req.ContentLength
 		}
+		return req, err
+	}, readBody)
+	end := time.Now()
+	res := requestResult{Err: err, Duration: end.Sub(requestStart), BytesSent: sent}
+	atomic.AddInt64(&lt.inFlight, -1)
+	client.phases.record(times, end)
+
+	res.Corrected = res.Duration
+	if !scheduled.IsZero() && scheduled.Before(requestStart) {
+		res.Corrected += requestStart.Sub(scheduled)
 	}
 
-	if method == "" {
-		method = "GET"
+	if resp != nil {
+		res.StatusCode = resp.StatusCode
+		res.BytesRecv = resp.Size
+		res.BodyHash = resp.Hash
 	}
+	return resp, res
+}
 
-	var req *http.Request
-	var err error
+// finish stops the run that owns ctx from inside the tester itself, e.g. when
+// its duration is over or a replay file runs out. It must be called from the
+// scheduling goroutine: requests already in flight are allowed to complete
+// before the run stops. It is a no-op if that run was already stopped.
+func (lt *LoadTester) finish(ctx context.Context, reason string) {
+	lt.wg.Wait()
+	lt.stopLater(ctx, reason)
+}
 
-	if needsBody && method == "POST" && endpoint == "/api/animals" {
-		animal := generateRandomAnimal()
-		body, marshalErr := json.Marshal(animal)
-		if marshalErr != nil {
-			return marshalErr
+// stopLater stops the run that owns ctx without waiting for it, so it can be
+// called while holding lt.mutex or from goroutines that stop waits for. It is
+// a no-op if that run was already stopped.
+func (lt *LoadTester) stopLater(ctx context.Context, reason string) {
+	go func() {
+		testerMutex.Lock()
+		defer testerMutex.Unlock()
+
+		if lt.ctx == ctx && lt.state.Running {
+			lt.stop(reason)
 		}
+	}()
+}
 
-		req, err = http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(body))
-		if err == nil {
-			req.Header.Set("Content-Type", "application/json")
+func (lt *LoadTester) recordResult(ep EndpointConfig, res requestResult) {
+	lt.recordRequest(ep, res, func() *endpointCounters {
+		return lt.endpointStats[ep.Key()]
+	})
+}
+
+// recordStep records one request of a scenario: in the run's totals like any
+// other request, and against step i of the scenario ep.
+func (lt *LoadTester) recordStep(ep EndpointConfig, i int, step EndpointConfig, res requestResult) {
+	lt.recordRequest(step, res, func() *endpointCounters {
+		if c := lt.endpointStats[ep.Key()]; c != nil && i < len(c.steps) {
+			return c.steps[i]
 		}
+		return nil
+	})
+}
+
+// recordIteration records a whole scenario iteration against the scenario,
+// with its end-to-end latency.
+func (lt *LoadTester) recordIteration(ep EndpointConfig, d, corrected time.Duration, failed bool) {
+	lt.mutex.Lock()
+	defer lt.mutex.Unlock()
+
+	if !lt.state.Running || atomic.LoadInt32(&lt.isRunning) == 0 {
+		return
+	}
+	if c := lt.endpointStats[ep.Key()]; c != nil {
+		c.observe(d, corrected, failed, false)
+	}
+}
+
+// recordRequest adds one request to the run's totals and to the counters
+// returned by counters, which is called with lt.mutex held.
+func (lt *LoadTester) recordRequest(ep EndpointConfig, res requestResult, counters func() *endpointCounters) {
+	if res.Err != nil && res.StatusCode == 0 && res.ErrorClass == "" {
+		res.ErrorClass = classifyError(res.Err)
+	}
+
+	metrics.observeRequest(ep, res)
+
+	lt.mutex.Lock()
+	defer lt.mutex.Unlock()
+
+	if !lt.state.Running || atomic.LoadInt32(&lt.isRunning) == 0 {
+		return
+	}
+
+	lt.state.TotalReqs++
+	lt.bytesSent += res.BytesSent
+	lt.bytesReceived += res.BytesRecv
+	lt.latency.Record(res.Duration)
+	lt.corrected.Record(res.Corrected)
+	lt.window.Record(res.Duration)
+
+	if c := counters(); c != nil {
+		c.observe(res.Duration, res.Corrected, res.Err != nil, res.Assertion != "")
+		c.observeBody(res.BytesSent, res.BytesRecv, res.BodyHash)
+	}
+
+	if res.StatusCode > 0 {
+		lt.state.StatusCodes[strconv.Itoa(res.StatusCode)]++
+	}
+	if res.ErrorClass != "" {
+		lt.state.ErrorClasses[res.ErrorClass]++
+	}
+	if res.Assertion != "" {
+		lt.state.Assertions[res.Assertion]++
+	}
+	if res.Err != nil {
+		lt.state.ErrorReqs++
 	} else {
-		req, err = http.NewRequestWithContext(ctx, method, url, nil)
+		lt.state.SuccessReqs++
 	}
+}
 
-	if err != nil {
-		return err
+func copyCounts(src map[string]int64) map[string]int64 {
+	dst := make(map[string]int64, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+// maxResponseBody caps how much of a response body is kept for scenario
+// extraction and assertions; the rest is only counted.
+const maxResponseBody = 1 << 20
+
+var errBodyTruncated = fmt.Errorf("response body is over %d bytes and was not checked", maxResponseBody)
+
+type responseData struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Size       int64
+	Hash       string
+	// Truncated is set when Body holds only the first maxResponseBody
+	// bytes of the response.
+	Truncated bool
+
+	doc    interface{}
+	docErr error
+	parsed bool
+}
+
+// json decodes the body once and returns the cached document afterwards.
+func (r *responseData) json() (interface{}, error) {
+	if !r.parsed {
+		r.parsed = true
+		r.docErr = json.Unmarshal(r.Body, &r.doc)
 	}
+	return r.doc, r.docErr
+}
 
-	req.Header.Set("User-Agent", "AnimalShelter-LoadTester/1.0")
+func makeRequestWithContext(ctx context.Context, client *runClient, baseURL string, build requestBuilder, readBody bool) (*responseData, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	req, err := build(ctx, baseURL)
+	if err != nil {
+		return nil, err
+	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	data := &responseData{StatusCode: resp.StatusCode, Header: resp.Header}
+	h := newBodyHash(client.hashBodies)
+	var body io.Reader = resp.Body
+	if h != nil {
+		body = io.TeeReader(resp.Body, h)
+	}
+	if readBody {
+		if data.Body, err = io.ReadAll(io.LimitReader(body, maxResponseBody)); err != nil {
+			return data, err
+		}
+		rest, err := io.Copy(io.Discard, body)
+		if err != nil {
+			return data, err
+		}
+		data.Size = int64(len(data.Body)) + rest
+		data.Truncated = rest > 0
+	} else if data.Size, err = io.Copy(io.Discard, body); err != nil {
+		// The body is drained even when nobody looks at it, so that the
+		// connection can go back to the pool.
+		return data, err
+	}
+	data.Hash = hashString(h)
+
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+		return data, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
 	}
 
-	return nil
+	return data, nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestLabels struct {
+	endpoint string
+	method   string
+	code     string
+}
+
+type errorLabels struct {
+	endpoint string
+	method   string
+	class    string
+}
+
+type durationLabels struct {
+	endpoint string
+	method   string
+}
+
+type promHistogram struct {
+	buckets []int64
+	count   int64
+	sum     float64
+}
+
+// Metrics counters live for the whole process, unlike AppState which is reset
+// on every /start, because Prometheus expects them to be monotonic.
+type metricsRegistry struct {
+	mu         sync.Mutex
+	requests   map[requestLabels]int64
+	errors     map[errorLabels]int64
+	assertions map[errorLabels]int64
+	durations  map[durationLabels]*promHistogram
+}
+
+var metrics = &metricsRegistry{
+	requests:   make(map[requestLabels]int64),
+	errors:     make(map[errorLabels]int64),
+	assertions: make(map[errorLabels]int64),
+	durations:  make(map[durationLabels]*promHistogram),
+}
+
+func (m *metricsRegistry) observeRequest(ep EndpointConfig, res requestResult) {
+	code := "error"
+	if res.StatusCode > 0 {
+		code = strconv.Itoa(res.StatusCode)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestLabels{endpoint: ep.Path, method: ep.Method, code: code}]++
+	if res.ErrorClass != "" {
+		m.errors[errorLabels{endpoint: ep.Path, method: ep.Method, class: res.ErrorClass}]++
+	}
+	if res.Assertion != "" {
+		m.assertions[errorLabels{endpoint: ep.Path, method: ep.Method, class: res.Assertion}]++
+	}
+
+	key := durationLabels{endpoint: ep.Path, method: ep.Method}
+	h, ok := m.durations[key]
+	if !ok {
+		h = &promHistogram{buckets: make([]int64, len(durationBuckets))}
+		m.durations[key] = h
+	}
+
+	seconds := res.Duration.Seconds()
+	for i, le := range durationBuckets {
+		if seconds <= le {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+func (m *metricsRegistry) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP loadtester_requests_total Requests sent by the load tester.")
+	fmt.Fprintln(w, "# TYPE loadtester_requests_total counter")
+	requestKeys := make([]requestLabels, 0, len(m.requests))
+	for k := range m.requests {
+		requestKeys = append(requestKeys, k)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		a, b := requestKeys[i], requestKeys[j]
+		if a.endpoint != b.endpoint {
+			return a.endpoint < b.endpoint
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	for _, k := range requestKeys {
+		fmt.Fprintf(w, "loadtester_requests_total{endpoint=%s,method=%s,code=%s} %d\n",
+			quoteLabel(k.endpoint), quoteLabel(k.method), quoteLabel(k.code), m.requests[k])
+	}
+
+	fmt.Fprintln(w, "# HELP loadtester_request_errors_total Transport-level request failures by error class.")
+	fmt.Fprintln(w, "# TYPE loadtester_request_errors_total counter")
+	for _, k := range sortedErrorLabels(m.errors) {
+		fmt.Fprintf(w, "loadtester_request_errors_total{endpoint=%s,method=%s,class=%s} %d\n",
+			quoteLabel(k.endpoint), quoteLabel(k.method), quoteLabel(k.class), m.errors[k])
+	}
+
+	fmt.Fprintln(w, "# HELP loadtester_assertion_failures_total Responses that failed their endpoint's assertions, by check.")
+	fmt.Fprintln(w, "# TYPE loadtester_assertion_failures_total counter")
+	for _, k := range sortedErrorLabels(m.assertions) {
+		fmt.Fprintf(w, "loadtester_assertion_failures_total{endpoint=%s,method=%s,check=%s} %d\n",
+			quoteLabel(k.endpoint), quoteLabel(k.method), quoteLabel(k.class), m.assertions[k])
+	}
+
+	fmt.Fprintln(w, "# HELP loadtester_request_duration_seconds Client-side request latency measured by the load tester.")
+	fmt.Fprintln(w, "# TYPE loadtester_request_duration_seconds histogram")
+	durationKeys := make([]durationLabels, 0, len(m.durations))
+	for k := range m.durations {
+		durationKeys = append(durationKeys, k)
+	}
+	sort.Slice(durationKeys, func(i, j int) bool {
+		a, b := durationKeys[i], durationKeys[j]
+		if a.endpoint != b.endpoint {
+			return a.endpoint < b.endpoint
+		}
+		return a.method < b.method
+	})
+	for _, k := range durationKeys {
+		h := m.durations[k]
+		labels := fmt.Sprintf("endpoint=%s,method=%s", quoteLabel(k.endpoint), quoteLabel(k.method))
+		for i, le := range durationBuckets {
+			fmt.Fprintf(w, "loadtester_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels, strconv.FormatFloat(le, 'g', -1, 64), h.buckets[i])
+		}
+		fmt.Fprintf(w, "loadtester_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "loadtester_request_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "loadtester_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+}
+
+func sortedErrorLabels(counts map[errorLabels]int64) []errorLabels {
+	keys := make([]errorLabels, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.endpoint != b.endpoint {
+			return a.endpoint < b.endpoint
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.class < b.class
+	})
+	return keys
+}
+
+func quoteLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return `"` + v + `"`
+}
+
+func writeGauge(w io.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+	fmt.Fprintf(w, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	loadTester.mutex.RLock()
+	running := loadTester.state.Running
+	targetRPS := loadTester.state.RPS
+	currentRPS := loadTester.state.CurrentRPS
+	loadTester.mutex.RUnlock()
+
+	if !running {
+		targetRPS = 0
+	}
+	runningValue := 0.0
+	if running {
+		runningValue = 1
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeGauge(w, "loadtester_running", "Whether a load test is currently running.", runningValue)
+	writeGauge(w, "loadtester_target_rps", "Maximum RPS requested for the current run.", float64(targetRPS))
+	writeGauge(w, "loadtester_current_rps", "RPS currently produced by the load profile.", float64(currentRPS))
+	writeGauge(w, "loadtester_in_flight_requests", "Requests sent and still waiting for a response.", float64(atomic.LoadInt64(&loadTester.inFlight)))
+	metrics.write(w)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type MixEntry struct {
+	Endpoint string  `json:"endpoint"`
+	Method   string  `json:"method,omitempty"`
+	Weight   float64 `json:"weight"`
+}
+
+type EndpointStats struct {
+	Name        string       `json:"name"`
+	Method      string       `json:"method"`
+	Path        string       `json:"path"`
+	Share       float64      `json:"share"`
+	TotalReqs   int64        `json:"total_requests"`
+	SuccessReqs int64        `json:"success_requests"`
+	ErrorReqs   int64        `json:"error_requests"`
+	AssertReqs  int64        `json:"assertion_failures"`
+	Latency     LatencyStats `json:"latency"`
+	Corrected   LatencyStats `json:"corrected_latency"`
+	Traffic     TrafficStats `json:"traffic"`
+	// DistinctBodies counts different response bodies when they are
+	// hashed, up to maxTrackedBodies.
+	DistinctBodies int `json:"distinct_bodies,omitempty"`
+
+	// Steps holds per-step counters of a scenario; the scenario's own
+	// counters are for whole iterations with end-to-end latency.
+	Steps []EndpointStats `json:"steps,omitempty"`
+}
+
+type endpointCounters struct {
+	endpoint  EndpointConfig
+	share     float64
+	total     int64
+	success   int64
+	errors    int64
+	asserts   int64
+	latency   *Histogram
+	corrected *Histogram
+	sent      int64
+	received  int64
+	bodies    map[string]struct{}
+	steps     []*endpointCounters
+}
+
+type endpointPicker struct {
+	endpoints  []EndpointConfig
+	cumulative []float64
+	total      float64
+}
+
+func (ep EndpointConfig) Key() string {
+	return ep.Method + " " + ep.Path
+}
+
+func newEndpointPicker(mix []MixEntry) (*endpointPicker, error) {
+	if len(mix) == 0 {
+		return nil, fmt.Errorf("endpoint mix is empty")
+	}
+
+	p := &endpointPicker{}
+	for _, entry := range mix {
+		if entry.Weight <= 0 {
+			return nil, fmt.Errorf("weight for %s must be positive", entry.Endpoint)
+		}
+		ep := findEndpoint(entry.Method, entry.Endpoint)
+		if ep.Method == scenarioMethod && ep.scenario == nil {
+			return nil, fmt.Errorf("unknown scenario %s", entry.Endpoint)
+		}
+		p.total += entry.Weight
+		p.endpoints = append(p.endpoints, ep)
+		p.cumulative = append(p.cumulative, p.total)
+	}
+	return p, nil
+}
+
+func (p *endpointPicker) pick() EndpointConfig {
+	if len(p.endpoints) == 1 {
+		return p.endpoints[0]
+	}
+	idx := sort.SearchFloat64s(p.cumulative, rand.Float64()*p.total)
+	if idx >= len(p.endpoints) {
+		idx = len(p.endpoints) - 1
+	}
+	return p.endpoints[idx]
+}
+
+func (p *endpointPicker) next() (EndpointConfig, requestBuilder, bool) {
+	ep := p.pick()
+	return ep, func(ctx context.Context, baseURL string) (*http.Request, error) {
+		return ep.newRequest(ctx, baseURL, nil)
+	}, true
+}
+
+func (p *endpointPicker) counters() map[string]*endpointCounters {
+	result := make(map[string]*endpointCounters, len(p.endpoints))
+	prev := 0.0
+	for i, ep := range p.endpoints {
+		weight := p.cumulative[i] - prev
+		prev = p.cumulative[i]
+		if c, ok := result[ep.Key()]; ok {
+			c.share += weight / p.total
+			continue
+		}
+		result[ep.Key()] = newEndpointCounters(ep, weight/p.total)
+	}
+	return result
+}
+
+func newEndpointCounters(ep EndpointConfig, share float64) *endpointCounters {
+	c := &endpointCounters{endpoint: ep, share: share, latency: NewHistogram(), corrected: NewHistogram()}
+	if ep.scenario != nil {
+		for _, step := range ep.scenario.Steps {
+			c.steps = append(c.steps, newEndpointCounters(step.EndpointConfig, 0))
+		}
+	}
+	return c
+}
+
+func (c *endpointCounters) observe(d, corrected time.Duration, failed, assertion bool) {
+	c.total++
+	c.latency.Record(d)
+	c.corrected.Record(corrected)
+	if failed {
+		c.errors++
+	} else {
+		c.success++
+	}
+	if assertion {
+		c.asserts++
+	}
+}
+
+func (c *endpointCounters) observeBody(sent, received int64, hash string) {
+	c.sent += sent
+	c.received += received
+	if hash == "" {
+		return
+	}
+	if c.bodies == nil {
+		c.bodies = make(map[string]struct{})
+	}
+	if len(c.bodies) < maxTrackedBodies {
+		c.bodies[hash] = struct{}{}
+	}
+}
+
+func (c *endpointCounters) stats(elapsedSec float64) EndpointStats {
+	s := EndpointStats{
+		Name:        c.endpoint.Name,
+		Method:      c.endpoint.Method,
+		Path:        c.endpoint.Path,
+		Share:       c.share,
+		TotalReqs:   c.total,
+		SuccessReqs: c.success,
+		ErrorReqs:   c.errors,
+		AssertReqs:  c.asserts,
+		Latency:     c.latency.Stats(),
+		Corrected:   c.corrected.Stats(),
+
+		DistinctBodies: len(c.bodies),
+	}
+	if len(c.steps) == 0 {
+		s.Traffic = newTrafficStats(c.total, c.sent, c.received, elapsedSec)
+	}
+	for _, step := range c.steps {
+		s.Steps = append(s.Steps, step.stats(elapsedSec))
+	}
+	return s
+}
+
+func describeMix(mix []MixEntry) string {
+	parts := make([]string, 0, len(mix))
+	total := 0.0
+	for _, entry := range mix {
+		total += entry.Weight
+	}
+	for _, entry := range mix {
+		ep := findEndpoint(entry.Method, entry.Endpoint)
+		if len(mix) == 1 {
+			parts = append(parts, ep.Path)
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%.0f%% %s", entry.Weight/total*100, ep.Key()))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func endpointStatsList(counters map[string]*endpointCounters, elapsedSec float64) []EndpointStats {
+	list := make([]EndpointStats, 0, len(counters))
+	for _, c := range counters {
+		list = append(list, c.stats(elapsedSec))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Share != list[j].Share {
+			return list[i].Share > list[j].Share
+		}
+		return list[i].Method+" "+list[i].Path < list[j].Method+" "+list[j].Path
+	})
+	return list
+}
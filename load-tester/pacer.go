@@ -0,0 +1,224 @@
+package main
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxRPS             = 20000
+	defaultMaxInFlight = 2000
+
+	// pacerSlack is how early an arrival may be sent rather than sleeping
+	// for it: shorter waits cost more in timer wake-ups than they gain.
+	pacerSlack = 50 * time.Microsecond
+	// pacerMaxLag is how far the scheduler may fall behind before the
+	// arrivals it missed are dropped instead of being sent in one burst.
+	pacerMaxLag = time.Second
+	// pacerMaxBatch caps the arrivals sent per wake-up, so that stop and
+	// profile changes are still noticed while catching up.
+	pacerMaxBatch = 1000
+	// maxOmitted caps the dropped arrivals waiting for a request to complete
+	// before their corrected latency is recorded.
+	maxOmitted = 100000
+
+	arrivalUniform = "uniform"
+	arrivalPoisson = "poisson"
+	arrivalBursty  = "bursty"
+)
+
+// pacer schedules open-model arrivals: the send time of every request is
+// fixed in advance from the target rate, independent of how long earlier
+// requests take, so a slow target cannot slow the load down. Arrival times
+// are kept as absolute times rather than ticks, so late wake-ups are caught
+// up in batches instead of drifting.
+//
+// The gap before each arrival is drawn from the profile's arrival
+// distribution in units of the mean interval, so a rate change rescales the
+// pending gap instead of redrawing it.
+type pacer struct {
+	arrival  string
+	burstOn  time.Duration
+	burstOff time.Duration
+	start    time.Time
+
+	interval time.Duration
+	last     time.Time
+	units    float64
+	next     time.Time
+}
+
+type PacingStats struct {
+	Scheduled int64        `json:"scheduled"`
+	Sent      int64        `json:"sent"`
+	Dropped   int64        `json:"dropped"`
+	SendLag   LatencyStats `json:"send_lag"`
+}
+
+func newPacer(start time.Time, rps int, params ProfileParams) *pacer {
+	p := &pacer{
+		arrival:  params.Arrival,
+		burstOn:  time.Duration(params.BurstOnSec * float64(time.Second)),
+		burstOff: time.Duration(floatOr(params.BurstOffSec, defaultBurstOffSec) * float64(time.Second)),
+		start:    start,
+		last:     start,
+		interval: rateInterval(rps),
+	}
+	p.units = p.drawGap()
+	p.schedule()
+	return p
+}
+
+func rateInterval(rps int) time.Duration {
+	return time.Duration(float64(time.Second) / float64(rps))
+}
+
+// drawGap returns the gap before the next arrival in mean intervals.
+func (p *pacer) drawGap() float64 {
+	if p.arrival == arrivalPoisson {
+		return rand.ExpFloat64()
+	}
+	return 1
+}
+
+// schedule sets next from the previous arrival and the pending gap. Bursty
+// arrivals are squeezed into the on part of every on/off cycle, at a rate
+// that keeps the average of the whole cycle at the target.
+func (p *pacer) schedule() {
+	if p.arrival != arrivalBursty {
+		p.next = p.last.Add(time.Duration(p.units * float64(p.interval)))
+		return
+	}
+
+	cycle := p.burstOn + p.burstOff
+	gap := time.Duration(p.units * float64(p.interval) * float64(p.burstOn) / float64(cycle))
+	next := p.last.Add(gap)
+	if phase := next.Sub(p.start) % cycle; phase >= p.burstOn {
+		next = next.Add(cycle - phase + (phase-p.burstOn)%p.burstOn)
+	}
+	p.next = next
+}
+
+// setRate changes the rate from the next arrival on: it is moved as if the
+// gap since the previous one had been drawn at the new rate.
+func (p *pacer) setRate(rps int) {
+	p.interval = rateInterval(rps)
+	p.schedule()
+}
+
+// setArrival switches to the arrival distribution of params from the next
+// arrival on.
+func (p *pacer) setArrival(params ProfileParams) {
+	p.arrival = params.Arrival
+	p.burstOn = time.Duration(params.BurstOnSec * float64(time.Second))
+	p.burstOff = time.Duration(floatOr(params.BurstOffSec, defaultBurstOffSec) * float64(time.Second))
+	p.units = p.drawGap()
+	p.schedule()
+}
+
+func (p *pacer) peek() time.Time {
+	return p.next
+}
+
+func (p *pacer) advance() time.Time {
+	at := p.next
+	p.last = at
+	p.units = p.drawGap()
+	p.schedule()
+	return at
+}
+
+// due reports whether the next arrival should be sent at now.
+func (p *pacer) due(now time.Time) bool {
+	return !p.next.After(now.Add(pacerSlack))
+}
+
+// skipLagging drops arrivals scheduled more than pacerMaxLag before now and
+// returns when they were scheduled.
+func (p *pacer) skipLagging(now time.Time) []time.Time {
+	var skipped []time.Time
+	for limit := now.Add(-pacerMaxLag); p.next.Before(limit); {
+		skipped = append(skipped, p.advance())
+	}
+	return skipped
+}
+
+// wait returns how long to sleep until the next arrival.
+func (p *pacer) wait(now time.Time) time.Duration {
+	if d := p.next.Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+func (lt *LoadTester) pacingStats() PacingStats {
+	return PacingStats{
+		Scheduled: atomic.LoadInt64(&lt.scheduled),
+		Sent:      atomic.LoadInt64(&lt.sent),
+		Dropped:   atomic.LoadInt64(&lt.dropped),
+		SendLag:   lt.sendLag.Stats(),
+	}
+}
+
+// omittedArrival is an arrival that was never sent, because the run was at
+// max_in_flight or the scheduler fell behind.
+type omittedArrival struct {
+	key       string
+	scheduled time.Time
+}
+
+// omit records that the arrival scheduled at scheduled for the endpoint with
+// key was dropped; key is empty if no endpoint had been picked for it yet.
+// Dropping it must not hide the wait it would have had from the corrected
+// latency, so it is kept until the next request completes and then recorded
+// as if it had completed at the same time. If too many are waiting they are
+// recorded at once, as late as they are by then.
+func (lt *LoadTester) omit(key string, scheduled time.Time) {
+	lt.mutex.Lock()
+	defer lt.mutex.Unlock()
+
+	if !lt.state.Running || atomic.LoadInt32(&lt.isRunning) == 0 {
+		return
+	}
+	lt.omitted = append(lt.omitted, omittedArrival{key: key, scheduled: scheduled})
+	if len(lt.omitted) >= maxOmitted {
+		lt.flushOmittedLocked(time.Now())
+	}
+}
+
+// flushOmitted records the arrivals dropped so far with a request that
+// completed at now.
+func (lt *LoadTester) flushOmitted(now time.Time) {
+	lt.mutex.Lock()
+	defer lt.mutex.Unlock()
+
+	if !lt.state.Running || atomic.LoadInt32(&lt.isRunning) == 0 {
+		return
+	}
+	lt.flushOmittedLocked(now)
+}
+
+// flushOmittedLocked records now - scheduled of every waiting dropped arrival
+// as its corrected latency, in the run's totals and for its endpoint if it
+// has one.
+func (lt *LoadTester) flushOmittedLocked(now time.Time) {
+	for _, o := range lt.omitted {
+		d := now.Sub(o.scheduled)
+		lt.corrected.Record(d)
+		if c := lt.endpointStats[o.key]; c != nil {
+			c.corrected.Record(d)
+		}
+	}
+	lt.omitted = lt.omitted[:0]
+}
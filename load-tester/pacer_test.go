@@ -0,0 +1,265 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var pacerStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestPacerUniformRate(t *testing.T) {
+	p := newPacer(pacerStart, 4000, ProfileParams{Arrival: arrivalUniform})
+
+	var prev time.Time
+	for i := 1; i <= 4000; i++ {
+		at := p.advance()
+		if want := pacerStart.Add(time.Duration(i) * 250 * time.Microsecond); at.Sub(want).Abs() > time.Microsecond {
+			t.Fatalf("arrival %d at %v, want %v", i, at.Sub(pacerStart), want.Sub(pacerStart))
+		}
+		if !at.After(prev) {
+			t.Fatalf("arrival %d at %v is not after the previous one", i, at.Sub(pacerStart))
+		}
+		prev = at
+	}
+}
+
+func TestPacerSetRate(t *testing.T) {
+	p := newPacer(pacerStart, 10, ProfileParams{Arrival: arrivalUniform})
+	first := p.advance()
+
+	// The pending gap is rescaled to the new rate from the last arrival.
+	p.setRate(1000)
+	if got := p.peek().Sub(first); got != time.Millisecond {
+		t.Errorf("gap after speeding up: %v", got)
+	}
+}
+
+func TestPacerDue(t *testing.T) {
+	p := newPacer(pacerStart, 1000, ProfileParams{Arrival: arrivalUniform})
+	next := p.peek()
+
+	if p.due(next.Add(-time.Millisecond)) {
+		t.Error("due a millisecond early")
+	}
+	if !p.due(next.Add(-pacerSlack)) {
+		t.Error("not due within the slack")
+	}
+	if d := p.wait(next.Add(-time.Millisecond)); d != time.Millisecond {
+		t.Errorf("wait %v", d)
+	}
+	if d := p.wait(next.Add(time.Second)); d != 0 {
+		t.Errorf("wait for a late arrival %v", d)
+	}
+
+	// A late wake-up finds every missed arrival due, to be sent in batches.
+	now := pacerStart.Add(100 * time.Millisecond)
+	n := 0
+	for ; p.due(now); n++ {
+		p.advance()
+	}
+	if n != 100 {
+		t.Errorf("%d arrivals due after 100ms, want 100", n)
+	}
+}
+
+func TestPacerSkipLagging(t *testing.T) {
+	p := newPacer(pacerStart, 100, ProfileParams{Arrival: arrivalUniform})
+	now := pacerStart.Add(5 * time.Second)
+
+	skipped := p.skipLagging(now)
+	if len(skipped) != 399 {
+		t.Fatalf("skipped %d arrivals, want 399", len(skipped))
+	}
+	for i, at := range skipped {
+		if !at.Before(now.Add(-pacerMaxLag)) {
+			t.Fatalf("skipped arrival %d at %v is within the lag", i, at.Sub(pacerStart))
+		}
+		if i > 0 && !at.After(skipped[i-1]) {
+			t.Fatalf("skipped arrivals out of order at %d", i)
+		}
+	}
+	if next := p.peek(); next.Before(now.Add(-pacerMaxLag)) || next.After(now) {
+		t.Errorf("next arrival at %v", next.Sub(pacerStart))
+	}
+
+	if skipped := p.skipLagging(now); len(skipped) != 0 {
+		t.Errorf("skipped %d more", len(skipped))
+	}
+}
+
+func TestPacerPoissonRate(t *testing.T) {
+	p := newPacer(pacerStart, 1000, ProfileParams{Arrival: arrivalPoisson})
+
+	const n = 100000
+	var at time.Time
+	var sumSq float64
+	last := pacerStart
+	for i := 0; i < n; i++ {
+		at = p.advance()
+		gap := at.Sub(last).Seconds() * 1000
+		sumSq += gap * gap
+		last = at
+	}
+
+	// Exponential gaps of mean 1ms: the mean and the standard deviation are
+	// both 1ms, so the rate holds while single gaps vary.
+	mean := at.Sub(pacerStart).Seconds() * 1000 / n
+	if math.Abs(mean-1) > 0.02 {
+		t.Errorf("mean gap %.3fms, want 1ms", mean)
+	}
+	if sd := math.Sqrt(sumSq/n - mean*mean); math.Abs(sd-1) > 0.05 {
+		t.Errorf("gap stddev %.3fms, want 1ms", sd)
+	}
+}
+
+func TestPacerBursty(t *testing.T) {
+	params := ProfileParams{Arrival: arrivalBursty, BurstOnSec: 1, BurstOffSec: floatPtr(3)}
+	p := newPacer(pacerStart, 100, params)
+
+	// 100 RPS on average over 4s cycles is 400 arrivals in each 1s burst.
+	var at time.Time
+	for i := 0; i < 4000; i++ {
+		at = p.advance()
+		if phase := at.Sub(pacerStart) % (4 * time.Second); phase >= time.Second {
+			t.Fatalf("arrival %d at %v, in the off period", i, at.Sub(pacerStart))
+		}
+	}
+	if elapsed := at.Sub(pacerStart); elapsed < 39*time.Second || elapsed > 40*time.Second {
+		t.Errorf("4000 arrivals took %v, want 10 cycles of 4s", elapsed)
+	}
+}
+
+func TestPacerBurstyWithoutPause(t *testing.T) {
+	params := ProfileParams{Arrival: arrivalBursty, BurstOnSec: 1, BurstOffSec: floatPtr(0)}
+	params.applyDefaults()
+	if *params.BurstOffSec != 0 {
+		t.Fatalf("burst_off_sec 0 became %g", *params.BurstOffSec)
+	}
+	if err := params.validate("constant", 100); err != nil {
+		t.Fatal(err)
+	}
+
+	// With no pause it is the uniform schedule.
+	p := newPacer(pacerStart, 100, params)
+	for i := 1; i <= 500; i++ {
+		if at := p.advance(); at.Sub(pacerStart) != time.Duration(i)*10*time.Millisecond {
+			t.Fatalf("arrival %d at %v", i, at.Sub(pacerStart))
+		}
+	}
+}
+
+func TestPacerShortBursts(t *testing.T) {
+	for _, on := range []float64{0.0001, minBurstOnSec / 2} {
+		params := ProfileParams{Arrival: arrivalBursty, BurstOnSec: on, BurstOffSec: floatPtr(0)}
+		if err := params.validate("constant", 100); err == nil {
+			t.Errorf("burst_on_sec %g accepted", on)
+		}
+	}
+
+	// The shortest allowed period still paces, and keeps the average rate.
+	params := ProfileParams{Arrival: arrivalBursty, BurstOnSec: minBurstOnSec, BurstOffSec: floatPtr(minBurstOnSec)}
+	if err := params.validate("constant", 20000); err != nil {
+		t.Fatal(err)
+	}
+	p := newPacer(pacerStart, 20000, params)
+	var at time.Time
+	for i := 0; i < 20000; i++ {
+		at = p.advance()
+	}
+	if elapsed := at.Sub(pacerStart); elapsed < 990*time.Millisecond || elapsed > 1010*time.Millisecond {
+		t.Errorf("20000 arrivals at 20000 RPS took %v", elapsed)
+	}
+}
+
+func TestStalledTargetRaisesCorrectedLatency(t *testing.T) {
+	t.Setenv("DATA_DIR", t.TempDir())
+
+	// Requests 100-104 stall for half a second and take every in-flight
+	// slot, so the arrivals scheduled meanwhile are dropped. Only the five
+	// stalled requests are slow, well under 1% of those sent.
+	var n int64
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if i := atomic.AddInt64(&n, 1); i >= 100 && i < 105 {
+			time.Sleep(500 * time.Millisecond)
+		}
+	}))
+	defer target.Close()
+
+	cfg := RunConfig{
+		Target:      target.URL,
+		Mix:         []MixEntry{{Endpoint: "/stall", Method: http.MethodGet, Weight: 1}},
+		RPS:         500,
+		Profile:     "constant",
+		DurationSec: 2,
+		MaxInFlight: 5,
+	}
+	plan, err := newRunPlan(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lt := newLoadTester()
+	testerMutex.Lock()
+	lt.start(cfg, plan)
+	testerMutex.Unlock()
+
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		lt.mutex.RLock()
+		done := lt.state.Summary != nil
+		lt.mutex.RUnlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("run did not finish")
+		}
+	}
+
+	testerMutex.Lock()
+	s := lt.lastRecord.Summary
+	testerMutex.Unlock()
+
+	if s.Pacing.Dropped < 100 {
+		t.Fatalf("only %d arrivals dropped, the target did not stall the run", s.Pacing.Dropped)
+	}
+	if s.Corrected.P99 < 200 || s.Corrected.P99 < 10*s.Latency.P99 {
+		t.Errorf("corrected p99 %.1fms, raw p99 %.1fms", s.Corrected.P99, s.Latency.P99)
+	}
+	ep := s.PerEndpoint[0]
+	if ep.Corrected.P99 < 200 || ep.Corrected.P99 < 10*ep.Latency.P99 {
+		t.Errorf("endpoint corrected p99 %.1fms, raw p99 %.1fms", ep.Corrected.P99, ep.Latency.P99)
+	}
+}
+
+func TestOmittedArrivals(t *testing.T) {
+	lt := newLoadTester()
+	ep := EndpointConfig{Method: "GET", Path: "/animals"}
+	lt.endpointStats = map[string]*endpointCounters{ep.Key(): newEndpointCounters(ep, 1)}
+	lt.state.Running = true
+	atomic.StoreInt32(&lt.isRunning, 1)
+
+	// A dropped arrival counts for its endpoint, a skipped one only for the
+	// run.
+	lt.omit(ep.Key(), pacerStart)
+	lt.omit("", pacerStart.Add(time.Second))
+	lt.flushOmitted(pacerStart.Add(3 * time.Second))
+
+	if s := lt.corrected.Stats(); s.Count != 2 || s.Min != 2000 || s.Max != 3000 {
+		t.Errorf("run corrected latency %+v", s)
+	}
+	if s := lt.endpointStats[ep.Key()].corrected.Stats(); s.Count != 1 || s.Max != 3000 {
+		t.Errorf("endpoint corrected latency %+v", s)
+	}
+	if s := lt.latency.Stats(); s.Count != 0 {
+		t.Errorf("omitted arrivals recorded as sent: %+v", s)
+	}
+
+	lt.flushOmitted(pacerStart.Add(time.Hour))
+	if s := lt.corrected.Stats(); s.Count != 2 {
+		t.Errorf("flushed twice: %+v", s)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// PhaseStats breaks request latency down into connection phases. ConnWait
+// runs from asking the pool for a connection to getting one: next to nothing
+// for an idle pooled connection, the dial for a new one, and the client-side
+// queueing for a free one when max_conns_per_host is reached. DNS, connect
+// and TLS only happen on new connections, so their counts tell how many
+// requests opened one. TTFB runs from the request being written to the first
+// response byte, i.e. the server's queueing and handler time, and transfer
+// from there to the end of the body. After redirects, ConnWait, TTFB and
+// transfer are those of the final request.
+type PhaseStats struct {
+	ConnWait LatencyStats `json:"conn_wait"`
+	DNS      LatencyStats `json:"dns"`
+	Connect  LatencyStats `json:"connect"`
+	TLS      LatencyStats `json:"tls"`
+	TTFB     LatencyStats `json:"ttfb"`
+	Transfer LatencyStats `json:"transfer"`
+}
+
+type phaseHistograms struct {
+	connWait, dns, connect, tls, ttfb, transfer *Histogram
+}
+
+// phaseTimes are the httptrace timestamps of one request. The callbacks may
+// run on transport goroutines, hence the mutex.
+type phaseTimes struct {
+	mu                        sync.Mutex
+	getConn, gotConn          time.Time
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wroteRequest, firstByte   time.Time
+}
+
+func newPhaseHistograms() *phaseHistograms {
+	return &phaseHistograms{
+		connWait: NewHistogram(),
+		dns:      NewHistogram(),
+		connect:  NewHistogram(),
+		tls:      NewHistogram(),
+		ttfb:     NewHistogram(),
+		transfer: NewHistogram(),
+	}
+}
+
+func (t *phaseTimes) mark(at *time.Time, first bool) {
+	now := time.Now()
+	t.mu.Lock()
+	if !first || at.IsZero() {
+		*at = now
+	}
+	t.mu.Unlock()
+}
+
+// clientTrace records into t when each phase starts and ends. With several
+// addresses to try, connect spans from the first attempt to the last one.
+// Every hop of a redirect gets a connection, writes a request and reads a
+// response, so those timestamps keep the last hop's.
+func (t *phaseTimes) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn:              func(string) { t.mark(&t.getConn, false) },
+		GotConn:              func(httptrace.GotConnInfo) { t.mark(&t.gotConn, false) },
+		DNSStart:             func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart, true) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone, false) },
+		ConnectStart:         func(string, string) { t.mark(&t.connectStart, true) },
+		ConnectDone:          func(string, string, error) { t.mark(&t.connectDone, false) },
+		TLSHandshakeStart:    func() { t.mark(&t.tlsStart, true) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.mark(&t.tlsDone, false) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.mark(&t.wroteRequest, false) },
+		GotFirstResponseByte: func() { t.mark(&t.firstByte, false) },
+	}
+}
+
+func recordPhase(h *Histogram, start, end time.Time) {
+	if !start.IsZero() && !end.IsZero() && !end.Before(start) {
+		h.Record(end.Sub(start))
+	}
+}
+
+// record adds the phases of a request whose body was done with at end.
+func (h *phaseHistograms) record(t *phaseTimes, end time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	recordPhase(h.connWait, t.getConn, t.gotConn)
+	recordPhase(h.dns, t.dnsStart, t.dnsDone)
+	recordPhase(h.connect, t.connectStart, t.connectDone)
+	recordPhase(h.tls, t.tlsStart, t.tlsDone)
+	recordPhase(h.ttfb, t.wroteRequest, t.firstByte)
+	recordPhase(h.transfer, t.firstByte, end)
+}
+
+func (h *phaseHistograms) stats() PhaseStats {
+	return PhaseStats{
+		ConnWait: h.connWait.Stats(),
+		DNS:      h.dns.Stats(),
+		Connect:  h.connect.Stats(),
+		TLS:      h.tls.Stats(),
+		TTFB:     h.ttfb.Stats(),
+		Transfer: h.transfer.Stats(),
+	}
+}
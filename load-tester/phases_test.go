@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// phaseGet sends one GET through c with phase tracing, like send does.
+func phaseGet(t *testing.T, c *runClient, url string) {
+	t.Helper()
+	ctx, times := c.trace(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	c.phases.record(times, time.Now())
+}
+
+func TestPhasesAfterRedirect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer target.Close()
+
+	cfg := ClientConfig{}
+	cfg.applyDefaults()
+	c := newRunClient(cfg)
+	defer c.close()
+
+	phaseGet(t, c, target.URL+"/old")
+
+	s := c.phases.stats()
+	if s.TTFB.Count != 1 || s.TTFB.Min < 20 {
+		t.Errorf("ttfb of the redirected request: %+v", s.TTFB)
+	}
+	if s.ConnWait.Count != 1 || s.Connect.Count != 1 {
+		t.Errorf("conn wait %d, connect %d, want 1 each", s.ConnWait.Count, s.Connect.Count)
+	}
+}
+
+func TestPhasesConnWait(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer target.Close()
+
+	// With one connection allowed, the second request waits for the first.
+	cfg := ClientConfig{MaxConnsPerHost: 1}
+	cfg.applyDefaults()
+	c := newRunClient(cfg)
+	defer c.close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			phaseGet(t, c, target.URL)
+		}()
+	}
+	wg.Wait()
+
+	s := c.phases.stats().ConnWait
+	if s.Count != 2 || s.Max < 90 || s.Min > 50 {
+		t.Errorf("conn wait %+v", s)
+	}
+}
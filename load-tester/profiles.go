@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+const (
+	transitionLinear  = "linear"
+	transitionInstant = "instant"
+
+	defaultSpikeDelay        = 5
+	defaultStressBurstChance = 0.1
+	defaultBurstOnSec        = 1
+	defaultBurstOffSec       = 2
+	// minBurstOnSec keeps the on period of bursty arrivals a usable
+	// time.Duration.
+	minBurstOnSec = 0.001
+)
+
+type Stage struct {
+	Duration   float64 `json:"duration_sec"`
+	RPS        int     `json:"rps"`
+	Transition string  `json:"transition,omitempty"`
+}
+
+type ProfileParams struct {
+	RampDuration      float64  `json:"ramp_duration_sec,omitempty"`
+	SpikeDelay        *float64 `json:"spike_delay_sec,omitempty"`
+	SpikeHold         float64  `json:"spike_hold_sec,omitempty"`
+	WavePeriod        float64  `json:"wave_period_sec,omitempty"`
+	WaveMin           int      `json:"wave_min_rps,omitempty"`
+	StepDuration      float64  `json:"step_duration_sec,omitempty"`
+	StepCount         int      `json:"step_count,omitempty"`
+	StressBurstChance *float64 `json:"stress_burst_chance,omitempty"`
+	Stages            []Stage  `json:"stages,omitempty"`
+	Arrival           string   `json:"arrival,omitempty"`
+	BurstOnSec        float64  `json:"burst_on_sec,omitempty"`
+	BurstOffSec       *float64 `json:"burst_off_sec,omitempty"`
+}
+
+func (p *ProfileParams) applyDefaults() {
+	if p.RampDuration == 0 {
+		p.RampDuration = 60
+	}
+	if p.SpikeDelay == nil {
+		p.SpikeDelay = floatPtr(defaultSpikeDelay)
+	}
+	if p.WavePeriod == 0 {
+		p.WavePeriod = 60
+	}
+	if p.StepDuration == 0 {
+		p.StepDuration = 30
+	}
+	if p.StepCount == 0 {
+		p.StepCount = 5
+	}
+	if p.StressBurstChance == nil {
+		p.StressBurstChance = floatPtr(defaultStressBurstChance)
+	}
+	if p.Arrival == "" {
+		p.Arrival = arrivalUniform
+	}
+	if p.Arrival == "exponential" {
+		p.Arrival = arrivalPoisson
+	}
+	if p.Arrival == arrivalBursty && p.BurstOnSec == 0 {
+		p.BurstOnSec = defaultBurstOnSec
+	}
+	if p.Arrival == arrivalBursty && p.BurstOffSec == nil {
+		p.BurstOffSec = floatPtr(defaultBurstOffSec)
+	}
+	for i := range p.Stages {
+		if p.Stages[i].Transition == "" {
+			p.Stages[i].Transition = transitionLinear
+		}
+	}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+// floatOr returns *v, or def when v is unset.
+func floatOr(v *float64, def float64) float64 {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+// validate checks the parameters of profile for a run that peaks at peak RPS,
+// or peak virtual users.
+func (p ProfileParams) validate(profile string, peak int) error {
+	if p.RampDuration < 0 || floatOr(p.SpikeDelay, 0) < 0 || p.SpikeHold < 0 || p.WavePeriod < 0 || p.StepDuration < 0 {
+		return fmt.Errorf("profile durations must not be negative")
+	}
+	if p.StepCount < 0 {
+		return fmt.Errorf("step_count must not be negative")
+	}
+	if p.WaveMin < 0 || p.WaveMin > peak {
+		return fmt.Errorf("wave_min_rps must be between 0 and max RPS")
+	}
+	if chance := floatOr(p.StressBurstChance, 0); chance < 0 || chance > 1 {
+		return fmt.Errorf("stress_burst_chance must be between 0 and 1")
+	}
+	switch p.Arrival {
+	case arrivalUniform, arrivalPoisson:
+	case arrivalBursty:
+		if p.BurstOnSec < minBurstOnSec {
+			return fmt.Errorf("burst_on_sec must be at least %g", minBurstOnSec)
+		}
+		if floatOr(p.BurstOffSec, 0) < 0 {
+			return fmt.Errorf("burst_off_sec must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown arrival distribution %q", p.Arrival)
+	}
+
+	if profile != "custom" {
+		return nil
+	}
+	if len(p.Stages) == 0 {
+		return fmt.Errorf("custom profile requires at least one stage")
+	}
+	for i, stage := range p.Stages {
+		if stage.Duration <= 0 {
+			return fmt.Errorf("stage %d: duration must be positive", i+1)
+		}
+		if stage.RPS <= 0 {
+			return fmt.Errorf("stage %d: rps must be positive", i+1)
+		}
+		if stage.RPS > peak {
+			return fmt.Errorf("stage %d: rps %d is above the run's %d", i+1, stage.RPS, peak)
+		}
+		if stage.Transition != transitionLinear && stage.Transition != transitionInstant {
+			return fmt.Errorf("stage %d: unknown transition %q", i+1, stage.Transition)
+		}
+	}
+	return nil
+}
+
+func (p ProfileParams) maxStageRPS() int {
+	result := 0
+	for _, stage := range p.Stages {
+		if stage.RPS > result {
+			result = stage.RPS
+		}
+	}
+	return result
+}
+
+func (p ProfileParams) stageRPS(elapsed float64) int {
+	from := 1
+	start := 0.0
+	for _, stage := range p.Stages {
+		if elapsed < start+stage.Duration {
+			if stage.Transition == transitionInstant {
+				return stage.RPS
+			}
+			progress := (elapsed - start) / stage.Duration
+			return int(math.Round(float64(from) + float64(stage.RPS-from)*progress))
+		}
+		from = stage.RPS
+		start += stage.Duration
+	}
+	return from
+}
+
+// profileStage returns which stage a staged profile (custom or step) is in at
+// elapsed, or 0 for profiles without stages.
+func profileStage(profile string, params ProfileParams, elapsed float64) int {
+	switch profile {
+	case "custom":
+		end := 0.0
+		for i, stage := range params.Stages {
+			end += stage.Duration
+			if elapsed < end {
+				return i
+			}
+		}
+		return max(len(params.Stages)-1, 0)
+	case "step":
+		if params.StepDuration <= 0 {
+			return 0
+		}
+		return min(int(elapsed/params.StepDuration), max(params.StepCount-1, 0))
+	default:
+		return 0
+	}
+}
+
+func profileRPS(profile string, maxRPS int, params ProfileParams, elapsed float64) int {
+	switch profile {
+	case "constant":
+		return maxRPS
+	case "ramp_up":
+		if elapsed >= params.RampDuration {
+			return maxRPS
+		}
+		progress := elapsed / params.RampDuration
+		return int(1 + float64(maxRPS-1)*progress)
+	case "spike":
+		delay := floatOr(params.SpikeDelay, defaultSpikeDelay)
+		if elapsed < delay {
+			return 1
+		}
+		if params.SpikeHold > 0 && elapsed >= delay+params.SpikeHold {
+			return 1
+		}
+		return maxRPS
+	case "wave":
+		amplitude := float64(maxRPS-params.WaveMin) / 2
+		baseline := float64(params.WaveMin) + amplitude
+		wave := math.Sin(2 * math.Pi * elapsed / params.WavePeriod)
+		return int(baseline + amplitude*wave)
+	case "step":
+		step := int(elapsed / params.StepDuration)
+		stepSize := maxRPS / params.StepCount
+		if stepSize == 0 {
+			stepSize = 1
+		}
+		rps := (step + 1) * stepSize
+		if rps > maxRPS {
+			return maxRPS
+		}
+		return rps
+	case "stress":
+		baseRPS := maxRPS / 3
+		if rand.Float64() < floatOr(params.StressBurstChance, defaultStressBurstChance) {
+			return maxRPS
+		}
+		variableRPS := baseRPS
+		if maxRPS >= 2 {
+			variableRPS += rand.Intn(maxRPS / 2)
+		}
+		if variableRPS > maxRPS {
+			return maxRPS
+		}
+		return variableRPS
+	case "custom":
+		return params.stageRPS(elapsed)
+	default:
+		return maxRPS
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	replayModeOriginal = "original"
+	replayModeScaled   = "scaled"
+	replayModeFixedRPS = "fixed_rps"
+)
+
+type ReplayConfig struct {
+	File  string  `json:"file"`
+	Mode  string  `json:"mode"`
+	Speed float64 `json:"speed,omitempty"`
+	Loop  bool    `json:"loop"`
+}
+
+type ReplayEntry struct {
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Body     json.RawMessage   `json:"body,omitempty"`
+	OffsetMs *float64          `json:"offset_ms,omitempty"`
+
+	body []byte
+	line int
+}
+
+type replaySource struct {
+	entries []ReplayEntry
+	loop    bool
+
+	mu  sync.Mutex
+	pos int
+}
+
+func replayDir() string {
+	return getEnv("REPLAY_DIR", "replays")
+}
+
+func replayPath(name string) string {
+	return filepath.Join(replayDir(), filepath.Clean("/"+name))
+}
+
+func loadReplayFile(name string) ([]ReplayEntry, error) {
+	f, err := os.Open(replayPath(name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseReplay(f)
+}
+
+func parseReplay(r io.Reader) ([]ReplayEntry, error) {
+	var entries []ReplayEntry
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		entry := ReplayEntry{line: line}
+		if err := json.Unmarshal(text, &entry); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		entry.Method = strings.ToUpper(entry.Method)
+		if entry.Method == "" {
+			entry.Method = "GET"
+		}
+		if !allowedMethods[entry.Method] {
+			return nil, fmt.Errorf("line %d: unsupported method %q", line, entry.Method)
+		}
+		if !strings.HasPrefix(entry.Path, "/") {
+			return nil, fmt.Errorf("line %d: path %q must start with /", line, entry.Path)
+		}
+
+		if len(entry.Body) > 0 && string(entry.Body) != "null" {
+			var s string
+			if entry.Body[0] == '"' && json.Unmarshal(entry.Body, &s) == nil {
+				entry.body = []byte(s)
+			} else {
+				entry.body = []byte(entry.Body)
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("replay file contains no requests")
+	}
+
+	return entries, nil
+}
+
+func (cfg *ReplayConfig) validate(entries []ReplayEntry) error {
+	if cfg.Mode == "" {
+		cfg.Mode = replayModeOriginal
+	}
+
+	switch cfg.Mode {
+	case replayModeOriginal:
+		cfg.Speed = 1
+	case replayModeScaled:
+		if cfg.Speed <= 0 {
+			return fmt.Errorf("replay speed must be positive")
+		}
+	case replayModeFixedRPS:
+		return nil
+	default:
+		return fmt.Errorf("unknown replay mode %q", cfg.Mode)
+	}
+
+	// Entries are sent in file order, so an offset that goes backwards
+	// would be sent at once instead of when it was recorded.
+	var last *float64
+	for _, entry := range entries {
+		if entry.OffsetMs == nil {
+			continue
+		}
+		if last != nil && *entry.OffsetMs < *last {
+			return fmt.Errorf("line %d: offset_ms %g is before the previous %g, sort the file by offset_ms",
+				entry.line, *entry.OffsetMs, *last)
+		}
+		last = entry.OffsetMs
+	}
+	if last == nil {
+		return fmt.Errorf("replay file has no offset_ms values, use %s mode", replayModeFixedRPS)
+	}
+	return nil
+}
+
+func (e ReplayEntry) endpoint() EndpointConfig {
+	path := e.Path
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	return EndpointConfig{Name: "replay", Method: e.Method, Path: path}
+}
+
+func (e ReplayEntry) newRequest(ctx context.Context, baseURL string) (*http.Request, error) {
+	var body io.Reader
+	if e.body != nil {
+		body = bytes.NewReader(e.body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, e.Method, baseURL+e.Path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", "AnimalShelter-LoadTester/1.0")
+	if e.body != nil {
+		trimmed := bytes.TrimSpace(e.body)
+		if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	}
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// replayOffsets returns per-entry send offsets relative to the start of a
+// pass, and the length of one pass. Entries without offset_ms reuse the
+// previous entry's offset.
+func replayOffsets(entries []ReplayEntry, speed float64) ([]time.Duration, time.Duration) {
+	offsets := make([]time.Duration, len(entries))
+	last := 0.0
+	for i, entry := range entries {
+		if entry.OffsetMs != nil {
+			last = *entry.OffsetMs
+		}
+		offsets[i] = time.Duration(last / speed * float64(time.Millisecond))
+	}
+
+	first := offsets[0]
+	for i := range offsets {
+		offsets[i] -= first
+	}
+
+	passLength := offsets[len(offsets)-1]
+	if len(offsets) > 1 {
+		passLength += passLength / time.Duration(len(offsets)-1)
+	}
+	if passLength <= 0 {
+		passLength = time.Millisecond
+	}
+	return offsets, passLength
+}
+
+func newReplaySource(entries []ReplayEntry, loop bool) *replaySource {
+	return &replaySource{entries: entries, loop: loop}
+}
+
+func (s *replaySource) next() (EndpointConfig, requestBuilder, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pos >= len(s.entries) {
+		if !s.loop {
+			return EndpointConfig{}, nil, false
+		}
+		s.pos = 0
+	}
+
+	entry := s.entries[s.pos]
+	s.pos++
+	return entry.endpoint(), entry.newRequest, true
+}
+
+func (s *replaySource) counters() map[string]*endpointCounters {
+	result := make(map[string]*endpointCounters)
+	for _, entry := range s.entries {
+		ep := entry.endpoint()
+		c, ok := result[ep.Key()]
+		if !ok {
+			c = newEndpointCounters(ep, 0)
+			result[ep.Key()] = c
+		}
+		c.share += 1 / float64(len(s.entries))
+	}
+	return result
+}
+
+func (lt *LoadTester) runReplay(cfg ReplayConfig, entries []ReplayEntry) {
+	defer atomic.StoreInt32(&lt.isRunning, 0)
+	ctx := lt.ctx
+	stopChan := lt.stopChan
+
+	lt.mutex.RLock()
+	targetURL := lt.config.Target
+	maxRequests := lt.state.MaxRequests
+	deadline, stopDeadline := runDeadline(lt.state.StartTime, lt.state.DurationSec)
+	lt.mutex.RUnlock()
+	defer stopDeadline()
+
+	offsets, passLength := replayOffsets(entries, cfg.Speed)
+
+	var sent int64
+	go lt.trackAchievedRPS(ctx, &sent, true)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	passStart := time.Now()
+	for {
+		for i, entry := range entries {
+			if wait := time.Until(passStart.Add(offsets[i])); wait > 0 {
+				timer.Reset(wait)
+				select {
+				case <-ctx.Done():
+					return
+				case <-stopChan:
+					return
+				case <-deadline:
+					lt.finish(ctx, stopReasonDuration)
+					return
+				case <-timer.C:
+				}
+			} else {
+				select {
+				case <-deadline:
+					lt.finish(ctx, stopReasonDuration)
+					return
+				default:
+				}
+			}
+
+			if atomic.LoadInt32(&lt.isRunning) == 0 {
+				return
+			}
+
+			if !lt.dispatch(targetURL, entry.endpoint(), entry.newRequest, passStart.Add(offsets[i])) {
+				continue
+			}
+			if n := atomic.AddInt64(&sent, 1); maxRequests > 0 && n >= maxRequests {
+				lt.finish(ctx, stopReasonMaxRequests)
+				return
+			}
+		}
+
+		if !cfg.Loop {
+			log.Println("📼 Replay file finished")
+			lt.finish(ctx, stopReasonExhausted)
+			return
+		}
+		passStart = passStart.Add(passLength)
+	}
+}
+
+// trackAchievedRPS reports every second how many requests were sent during
+// it. Timed replays have no profile, so for them that rate is also the
+// current target; virtual users runs have no target at all.
+func (lt *LoadTester) trackAchievedRPS(ctx context.Context, sent *int64, asTarget bool) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var last int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := atomic.LoadInt64(sent)
+			lt.mutex.Lock()
+			lt.state.AchievedRPS = int(current - last)
+			if asTarget {
+				lt.setCurrentRPSLocked(lt.state.AchievedRPS)
+			}
+			lt.mutex.Unlock()
+			last = current
+		}
+	}
+}
+
+func replaysHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		files, err := filepath.Glob(filepath.Join(replayDir(), "*.jsonl"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		names := make([]string, 0, len(files))
+		for _, f := range files {
+			names = append(names, filepath.Base(f))
+		}
+		sort.Strings(names)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(names)
+
+	case "POST":
+		name := filepath.Base(r.URL.Query().Get("name"))
+		if name == "" || name == "." || name == "/" {
+			http.Error(w, "name query parameter is required", http.StatusBadRequest)
+			return
+		}
+		if !strings.HasSuffix(name, ".jsonl") {
+			name += ".jsonl"
+		}
+
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		entries, err := parseReplay(bytes.NewReader(data))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := os.MkdirAll(replayDir(), 0o755); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := os.WriteFile(replayPath(name), data, 0o644); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("📼 Stored replay file %s with %d requests", name, len(entries))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "Stored %s with %d requests", name, len(entries))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
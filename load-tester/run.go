@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type RunConfig struct {
+	Target        string        `json:"target,omitempty"`
+	Endpoint      string        `json:"endpoint"`
+	Mix           []MixEntry    `json:"mix,omitempty"`
+	Replay        *ReplayConfig `json:"replay,omitempty"`
+	Users         *UsersConfig  `json:"users,omitempty"`
+	RPS           int           `json:"rps"`
+	Profile       string        `json:"profile"`
+	ProfileParams ProfileParams `json:"profile_params"`
+	DurationSec   float64       `json:"duration_sec,omitempty"`
+	MaxRequests   int64         `json:"max_requests,omitempty"`
+	MaxInFlight   int           `json:"max_in_flight,omitempty"`
+	Thresholds    []Threshold   `json:"thresholds,omitempty"`
+	Client        ClientConfig  `json:"client"`
+}
+
+type TimelineSample struct {
+	Elapsed     float64 `json:"t"`
+	TargetRPS   int     `json:"target_rps"`
+	AchievedRPS int64   `json:"achieved_rps"`
+	Errors      int64   `json:"errors"`
+	InFlight    int64   `json:"in_flight"`
+	Users       int     `json:"users,omitempty"`
+	SentBytes   int64   `json:"sent_bytes"`
+	RecvBytes   int64   `json:"recv_bytes"`
+	P50         float64 `json:"p50_ms"`
+	P95         float64 `json:"p95_ms"`
+	P99         float64 `json:"p99_ms"`
+}
+
+type runPlan struct {
+	source        requestSource
+	counters      map[string]*endpointCounters
+	replayEntries []ReplayEntry
+	timedReplay   bool
+	description   string
+}
+
+// newRunPlan validates cfg, fills in defaults and prepares the request source
+// for it, without touching the tester state.
+func newRunPlan(cfg *RunConfig) (*runPlan, error) {
+	plan := &runPlan{}
+	if cfg.Target == "" {
+		cfg.Target = getEnv("TARGET_URL", "http://localhost:8000")
+	}
+	cfg.Target = strings.TrimSuffix(cfg.Target, "/")
+
+	if cfg.Replay != nil {
+		entries, err := loadReplayFile(cfg.Replay.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load replay file: %w", err)
+		}
+		if err := cfg.Replay.validate(entries); err != nil {
+			return nil, err
+		}
+
+		replay := newReplaySource(entries, cfg.Replay.Loop)
+		plan.source, plan.counters, plan.replayEntries = replay, replay.counters(), entries
+		plan.timedReplay = cfg.Replay.Mode != replayModeFixedRPS
+		cfg.Mix = nil
+		cfg.Endpoint = "replay:" + cfg.Replay.File
+		plan.description = fmt.Sprintf("replay of %s (%s)", cfg.Replay.File, cfg.Replay.Mode)
+	} else {
+		if len(cfg.Mix) == 0 {
+			cfg.Mix = []MixEntry{{Endpoint: cfg.Endpoint, Weight: 1}}
+		}
+		picker, err := newEndpointPicker(cfg.Mix)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Endpoint == "" {
+			cfg.Endpoint = cfg.Mix[0].Endpoint
+		}
+		plan.source, plan.counters = picker, picker.counters()
+		plan.description = describeMix(cfg.Mix)
+	}
+
+	cfg.ProfileParams.applyDefaults()
+	if cfg.Users != nil {
+		if plan.timedReplay {
+			return nil, fmt.Errorf("virtual users can only replay files in %s mode", replayModeFixedRPS)
+		}
+		if cfg.Profile == "custom" && cfg.Users.Count == 0 {
+			cfg.Users.Count = cfg.ProfileParams.maxStageRPS()
+		}
+		if err := cfg.Users.validate(); err != nil {
+			return nil, err
+		}
+		if err := cfg.ProfileParams.validate(cfg.Profile, cfg.Users.Count); err != nil {
+			return nil, err
+		}
+		cfg.RPS = 0
+		plan.description += fmt.Sprintf(" by %d virtual users, think time %s", cfg.Users.Count, cfg.Users.ThinkTime)
+	} else {
+		// The stages of a custom profile set its peak, whatever rps says.
+		if peak := cfg.ProfileParams.maxStageRPS(); cfg.Profile == "custom" && peak > 0 {
+			cfg.RPS = peak
+		}
+		if !plan.timedReplay && (cfg.RPS <= 0 || cfg.RPS > maxRPS) {
+			return nil, fmt.Errorf("RPS must be between 1 and %d", maxRPS)
+		}
+		if err := cfg.ProfileParams.validate(cfg.Profile, cfg.RPS); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.DurationSec < 0 || cfg.MaxRequests < 0 || cfg.MaxInFlight < 0 {
+		return nil, fmt.Errorf("duration_sec, max_requests and max_in_flight must not be negative")
+	}
+	if cfg.MaxInFlight == 0 {
+		cfg.MaxInFlight = defaultMaxInFlight
+	}
+	if err := validateThresholds(cfg.Thresholds); err != nil {
+		return nil, err
+	}
+	if cfg.Users != nil {
+		for _, t := range cfg.Thresholds {
+			if t.Metric == thresholdRPSRatio {
+				return nil, fmt.Errorf("threshold %q: virtual users runs have no target RPS", t.Expr)
+			}
+		}
+	}
+	cfg.Client.applyDefaults()
+	if err := cfg.Client.validate(); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// start resets the tester state and launches a run described by cfg and plan.
+// testerMutex must be held and no run may be active.
+func (lt *LoadTester) start(cfg RunConfig, plan *runPlan) {
+	lt.forceStop()
+	lt.ctx, lt.cancel = context.WithCancel(context.Background())
+
+	lt.mutex.Lock()
+	lt.config = cfg
+	lt.state.RunID = newRunID()
+	lt.state.RPS = cfg.RPS
+	lt.state.CurrentRPS = 1
+	lt.state.Endpoint = cfg.Endpoint
+	lt.state.Mix = cfg.Mix
+	lt.state.Replay = cfg.Replay
+	lt.source = plan.source
+	lt.endpointStats = plan.counters
+	lt.state.Profile = cfg.Profile
+	lt.state.ProfileParams = cfg.ProfileParams
+	lt.state.DurationSec = cfg.DurationSec
+	lt.state.MaxRequests = cfg.MaxRequests
+	lt.state.Users = 0
+	lt.state.Events = nil
+	if cfg.Users != nil {
+		lt.state.MaxUsers = cfg.Users.Count
+	} else {
+		lt.state.MaxUsers = 0
+	}
+	lt.state.Thresholds = newThresholdResults(cfg.Thresholds)
+	lt.state.Summary = nil
+	lt.state.Running = true
+	lt.state.TotalReqs = 0
+	lt.state.SuccessReqs = 0
+	lt.state.ErrorReqs = 0
+	lt.state.StatusCodes = make(map[string]int64)
+	lt.state.ErrorClasses = make(map[string]int64)
+	lt.state.Assertions = make(map[string]int64)
+	lt.state.StartTime = time.Now()
+	lt.latency.Reset()
+	lt.corrected.Reset()
+	lt.omitted = lt.omitted[:0]
+	lt.sendLag.Reset()
+	lt.slots = make(chan struct{}, cfg.MaxInFlight)
+	lt.client.close()
+	lt.client = newRunClient(cfg.Client)
+	lt.bytesSent, lt.bytesReceived = 0, 0
+	atomic.StoreInt64(&lt.scheduled, 0)
+	atomic.StoreInt64(&lt.sent, 0)
+	atomic.StoreInt64(&lt.dropped, 0)
+	lt.window = NewHistogram()
+	lt.timeline.reset()
+	lt.targetIntegral = 0
+	lt.targetSince = lt.state.StartTime
+	lt.profileStart = lt.state.StartTime
+	select {
+	case <-lt.adjusted:
+	default:
+	}
+
+	lt.state.AchievedRPS = 0
+	if rps := profileRPS(cfg.Profile, cfg.RPS, cfg.ProfileParams, 0); rps > 0 {
+		lt.state.CurrentRPS = rps
+	}
+	if cfg.Users != nil {
+		lt.state.CurrentRPS = 0
+	}
+	lt.mutex.Unlock()
+
+	atomic.StoreInt32(&lt.isRunning, 1)
+	events.publish(eventStarted, StartedEvent{RunID: lt.state.RunID, Description: plan.description, Config: cfg})
+	go lt.sampleTimeline(lt.ctx)
+	switch {
+	case plan.timedReplay:
+		go lt.runReplay(*cfg.Replay, plan.replayEntries)
+	case cfg.Users != nil:
+		go lt.runUsers(*cfg.Users)
+	default:
+		go lt.runLoadTest()
+	}
+}
+
+func newRunID() string {
+	var b [3]byte
+	rand.Read(b[:])
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b[:])
+}
+
+// sampleTimeline appends one TimelineSample per second of the run, with
+// latency percentiles taken from the requests completed during that second,
+// and publishes it to /events subscribers as a snapshot of the run.
+func (lt *LoadTester) sampleTimeline(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var lastTotal, lastErrors, lastSent, lastReceived int64
+	lastStage := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			lt.mutex.Lock()
+			window := lt.window
+			lt.window = NewHistogram()
+			sample := TimelineSample{
+				Elapsed:     time.Since(lt.state.StartTime).Seconds(),
+				TargetRPS:   lt.state.CurrentRPS,
+				AchievedRPS: lt.state.TotalReqs - lastTotal,
+				Errors:      lt.state.ErrorReqs - lastErrors,
+				InFlight:    atomic.LoadInt64(&lt.inFlight),
+				Users:       lt.state.Users,
+				SentBytes:   lt.bytesSent - lastSent,
+				RecvBytes:   lt.bytesReceived - lastReceived,
+			}
+			lastTotal, lastErrors = lt.state.TotalReqs, lt.state.ErrorReqs
+			lastSent, lastReceived = lt.bytesSent, lt.bytesReceived
+			stage := profileStage(lt.state.Profile, lt.state.ProfileParams, time.Since(lt.profileStart).Seconds())
+			runID := lt.state.RunID
+			lt.mutex.Unlock()
+
+			if stage != lastStage {
+				lastStage = stage
+				events.publish(eventStageChanged, StageChangedEvent{
+					RunID: runID, Stage: stage, Elapsed: sample.Elapsed, TargetRPS: sample.TargetRPS,
+				})
+			}
+
+			stats := window.Stats()
+			sample.P50, sample.P95, sample.P99 = stats.P50, stats.P95, stats.P99
+
+			in := thresholdInput{latency: stats, achievedRPS: float64(sample.AchievedRPS), targetRPS: float64(sample.TargetRPS)}
+			if sample.AchievedRPS > 0 {
+				in.errorRate = float64(sample.Errors) / float64(sample.AchievedRPS) * 100
+			}
+
+			lt.mutex.Lock()
+			if lt.ctx == ctx {
+				lt.timeline.push(sample)
+				if lt.state.Running {
+					lt.checkThresholdsLocked(ctx, in)
+				}
+			}
+			current := lt.ctx == ctx
+			lt.mutex.Unlock()
+
+			if current {
+				events.publish(eventSample, SampleEvent{RunID: runID, TimelineSample: sample})
+				events.publish(eventSnapshot, lt.snapshot())
+			}
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// scenarioMethod is the method of the pseudo-endpoint a scenario is selected
+// as in a mix, e.g. {"method": "SCENARIO", "endpoint": "new_animal"}.
+const scenarioMethod = "SCENARIO"
+
+const (
+	extractJSON   = "json"
+	extractRegex  = "regex"
+	extractHeader = "header"
+)
+
+// Scenario is a user journey: its steps run one after another, each step's
+// templates seeing the variables extracted from earlier responses. One
+// iteration of a scenario counts as one request of the run's load.
+type Scenario struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Steps       []ScenarioStep `json:"steps"`
+	Custom      bool           `json:"custom"`
+}
+
+type ScenarioStep struct {
+	EndpointConfig
+	Extract []Extractor `json:"extract,omitempty"`
+}
+
+// Extractor stores a value from a step's response in the scenario variable
+// Var: the first match of a JSONPath, the first group of a regexp (or the
+// whole match if it has none) or a response header.
+type Extractor struct {
+	Var  string `json:"var"`
+	From string `json:"from"`
+	Expr string `json:"expr"`
+
+	path jsonPath
+	re   *regexp.Regexp
+}
+
+var scenariosMutex sync.RWMutex
+
+var scenarios = []Scenario{
+	{
+		Name:        "new_animal",
+		Description: "Добавить животное и открыть его карточку",
+		Steps: []ScenarioStep{
+			{
+				EndpointConfig: EndpointConfig{Name: "Добавить животное", Method: "POST", Path: "/api/animals", Body: randomAnimalBody},
+				Extract:        []Extractor{{Var: "id", From: extractJSON, Expr: "$.id"}},
+			},
+			{
+				// The animal is looked up by id rather than in /animals,
+				// which grows with every iteration of this scenario.
+				EndpointConfig: EndpointConfig{
+					Name:   "Карточка животного",
+					Method: "GET",
+					Path:   "/api/animals/{{.id}}",
+					Assert: &Assertions{JSONPath: []JSONPathAssertion{{Path: "$.id", Equals: json.RawMessage(`"{{.id}}"`)}}},
+				},
+			},
+		},
+	},
+}
+
+func (s *Scenario) compile() error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return fmt.Errorf("scenario name is required")
+	}
+	if len(s.Steps) == 0 {
+		return fmt.Errorf("scenario %s has no steps", s.Name)
+	}
+
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		if err := step.EndpointConfig.compile(); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+		for j := range step.Extract {
+			if err := step.Extract[j].compile(); err != nil {
+				return fmt.Errorf("step %d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Extractor) compile() error {
+	if e.Var == "" {
+		return fmt.Errorf("extractor needs a var")
+	}
+	if e.From == "" {
+		e.From = extractJSON
+	}
+
+	var err error
+	switch e.From {
+	case extractJSON:
+		e.path, err = compileJSONPath(e.Expr)
+	case extractRegex:
+		e.re, err = regexp.Compile(e.Expr)
+	case extractHeader:
+		if e.Expr == "" {
+			err = fmt.Errorf("extractor %s needs a header name", e.Var)
+		}
+	default:
+		err = fmt.Errorf("extractor %s: unknown source %q", e.Var, e.From)
+	}
+	return err
+}
+
+func (e *Extractor) extract(resp *responseData) (string, *assertionError) {
+	switch e.From {
+	case extractHeader:
+		if v := resp.Header.Get(e.Expr); v != "" {
+			return v, nil
+		}
+	case extractRegex:
+		if m := e.re.FindSubmatch(resp.Body); m != nil {
+			if len(m) > 1 {
+				return string(m[1]), nil
+			}
+			return string(m[0]), nil
+		}
+	default:
+		doc, err := resp.json()
+		if err != nil {
+			return "", failAssertion(assertExtraction, "%s: body is not JSON: %v", e.Var, err)
+		}
+		if matches := e.path.find(doc); len(matches) > 0 {
+			return jsonString(matches[0]), nil
+		}
+	}
+	return "", failAssertion(assertExtraction, "%s: %s %q matched nothing", e.Var, e.From, e.Expr)
+}
+
+// endpoint returns the pseudo-endpoint the scenario is run as.
+func (s Scenario) endpoint() EndpointConfig {
+	sc := s
+	return EndpointConfig{
+		Name:        s.Name,
+		Method:      scenarioMethod,
+		Path:        s.Name,
+		Description: s.Description,
+		Custom:      s.Custom,
+		scenario:    &sc,
+	}
+}
+
+func initScenarios() error {
+	scenariosMutex.Lock()
+	for i := range scenarios {
+		if err := scenarios[i].compile(); err != nil {
+			scenariosMutex.Unlock()
+			return fmt.Errorf("built-in scenario %s: %w", scenarios[i].Name, err)
+		}
+	}
+	scenariosMutex.Unlock()
+
+	if path := os.Getenv("SCENARIOS_FILE"); path != "" {
+		return loadScenariosFile(path)
+	}
+	return nil
+}
+
+func loadScenariosFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var list []Scenario
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, s := range list {
+		if _, err := registerScenario(s); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, s.Name, err)
+		}
+	}
+
+	log.Printf("📄 Loaded %d scenarios from %s", len(list), path)
+	return nil
+}
+
+func listScenarios() []Scenario {
+	scenariosMutex.RLock()
+	defer scenariosMutex.RUnlock()
+
+	list := make([]Scenario, len(scenarios))
+	copy(list, scenarios)
+	return list
+}
+
+func findScenario(name string) (Scenario, bool) {
+	scenariosMutex.RLock()
+	defer scenariosMutex.RUnlock()
+
+	for _, s := range scenarios {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Scenario{}, false
+}
+
+func registerScenario(s Scenario) (Scenario, error) {
+	s.Custom = true
+	if err := s.compile(); err != nil {
+		return s, err
+	}
+
+	scenariosMutex.Lock()
+	defer scenariosMutex.Unlock()
+
+	for i := range scenarios {
+		if scenarios[i].Name == s.Name {
+			scenarios[i] = s
+			return s, nil
+		}
+	}
+	scenarios = append(scenarios, s)
+	return s, nil
+}
+
+func removeScenario(name string) (bool, error) {
+	scenariosMutex.Lock()
+	defer scenariosMutex.Unlock()
+
+	for i := range scenarios {
+		if scenarios[i].Name != name {
+			continue
+		}
+		if !scenarios[i].Custom {
+			return false, fmt.Errorf("built-in scenario %s cannot be removed", name)
+		}
+		scenarios = append(scenarios[:i], scenarios[i+1:]...)
+		return true, nil
+	}
+	return false, nil
+}
+
+func scenariosHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(listScenarios())
+
+	case "POST":
+		var raw json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var list []Scenario
+		if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+			if err := json.Unmarshal(raw, &list); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		} else {
+			var s Scenario
+			if err := json.Unmarshal(raw, &s); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			list = append(list, s)
+		}
+
+		registered := make([]Scenario, 0, len(list))
+		for _, s := range list {
+			s, err := registerScenario(s)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%s: %v", s.Name, err), http.StatusBadRequest)
+				return
+			}
+			log.Printf("➕ Registered scenario %s (%d steps)", s.Name, len(s.Steps))
+			registered = append(registered, s)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(registered)
+
+	case "DELETE":
+		name := r.URL.Query().Get("name")
+		removed, err := removeScenario(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !removed {
+			http.Error(w, "Scenario not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("➖ Removed scenario %s", name)
+		fmt.Fprintf(w, "Removed")
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// runScenario runs one iteration of a scenario. Each step is recorded as a
+// request of the run and of the step; the iteration as a whole is recorded
+// against the scenario with its end-to-end latency. The first failed step
+// ends the iteration, as later steps usually depend on it.
+func (lt *LoadTester) runScenario(targetURL string, ep EndpointConfig, scheduled time.Time) {
+	vars := make(map[string]string)
+	start := time.Now()
+	failed := false
+
+	for i := range ep.scenario.Steps {
+		step := ep.scenario.Steps[i]
+		// Only the first step waits for the scheduler; the others follow
+		// their predecessor right away.
+		stepScheduled := scheduled
+		if i > 0 {
+			stepScheduled = time.Time{}
+		}
+		resp, res := lt.send(targetURL, func(ctx context.Context, baseURL string) (*http.Request, error) {
+			return step.newRequest(ctx, baseURL, vars)
+		}, true, stepScheduled)
+
+		step.Assert.apply(resp, &res, vars)
+		if res.Err == nil {
+			for j := range step.Extract {
+				if resp.Truncated && step.Extract[j].From != extractHeader {
+					res.truncated()
+					break
+				}
+				value, err := step.Extract[j].extract(resp)
+				if err != nil {
+					res.fail(err)
+					break
+				}
+				vars[step.Extract[j].Var] = value
+			}
+		}
+
+		if atomic.LoadInt32(&lt.isRunning) == 0 {
+			return
+		}
+		lt.recordStep(ep, i, step.EndpointConfig, res)
+		if res.Err != nil {
+			failed = true
+			break
+		}
+	}
+
+	d := time.Since(start)
+	corrected := d
+	if !scheduled.IsZero() && scheduled.Before(start) {
+		corrected += start.Sub(scheduled)
+	}
+	lt.recordIteration(ep, d, corrected, failed)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RunRecord struct {
+	ID         string           `json:"id"`
+	Config     RunConfig        `json:"config"`
+	Summary    *RunSummary      `json:"summary"`
+	Comparison *RunComparison   `json:"comparison,omitempty"`
+	Timeline   []TimelineSample `json:"timeline,omitempty"`
+	Events     []TimelineEvent  `json:"events,omitempty"`
+}
+
+type runStore struct {
+	mu sync.Mutex
+}
+
+var (
+	runs      = &runStore{}
+	runIDExpr = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+)
+
+func dataDir() string {
+	return getEnv("DATA_DIR", "data")
+}
+
+func (s *runStore) dir() string {
+	return filepath.Join(dataDir(), "runs")
+}
+
+func (s *runStore) path(id string) (string, error) {
+	if !runIDExpr.MatchString(id) {
+		return "", fmt.Errorf("invalid run id %q", id)
+	}
+	return filepath.Join(s.dir(), id+".json"), nil
+}
+
+func (s *runStore) save(record *RunRecord) error {
+	path, err := s.path(record.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir(), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *runStore) get(id string) (*RunRecord, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	data, err := os.ReadFile(path)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var record RunRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("run %s: %w", id, err)
+	}
+	return &record, nil
+}
+
+// list returns all stored runs, newest first, without their timelines.
+func (s *runStore) list() ([]RunRecord, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]RunRecord, 0, len(files))
+	for _, f := range files {
+		record, err := s.get(strings.TrimSuffix(filepath.Base(f), ".json"))
+		if err != nil {
+			log.Printf("⚠️ Skipping run file %s: %v", f, err)
+			continue
+		}
+		record.Timeline = nil
+		result = append(result, *record)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return runStartTime(result[i]).After(runStartTime(result[j]))
+	})
+	return result, nil
+}
+
+func (s *runStore) delete(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return os.Remove(path)
+}
+
+func runStartTime(record RunRecord) time.Time {
+	if record.Summary == nil {
+		return time.Time{}
+	}
+	return record.Summary.StartTime
+}
+
+func runsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, err := runs.list()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func runHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/runs/")
+	if !runIDExpr.MatchString(id) {
+		http.Error(w, "Run not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		record, err := runs.get(id)
+		if os.IsNotExist(err) {
+			http.Error(w, "Run not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(record)
+
+	case "DELETE":
+		err := runs.delete(id)
+		if os.IsNotExist(err) {
+			http.Error(w, "Run not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := baselines.unpin(id); err != nil {
+			log.Printf("⚠️ Failed to unpin baseline %s: %v", id, err)
+		}
+
+		log.Printf("🗑️ Deleted run %s", id)
+		fmt.Fprintf(w, "Deleted run %s", id)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
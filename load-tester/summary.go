@@ -0,0 +1,94 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	stopReasonManual      = "manual"
+	stopReasonDuration    = "duration"
+	stopReasonMaxRequests = "max_requests"
+	stopReasonExhausted   = "source_exhausted"
+	stopReasonShutdown    = "shutdown"
+	stopReasonThreshold   = "threshold"
+)
+
+type RunSummary struct {
+	StartTime    time.Time         `json:"start_time"`
+	EndTime      time.Time         `json:"end_time"`
+	DurationSec  float64           `json:"duration_sec"`
+	StopReason   string            `json:"stop_reason"`
+	TotalReqs    int64             `json:"total_requests"`
+	SuccessReqs  int64             `json:"success_requests"`
+	ErrorReqs    int64             `json:"error_requests"`
+	ErrorRate    float64           `json:"error_rate"`
+	TargetRPS    float64           `json:"target_rps"`
+	AchievedRPS  float64           `json:"achieved_rps"`
+	Latency      LatencyStats      `json:"latency"`
+	Corrected    LatencyStats      `json:"corrected_latency"`
+	Pacing       PacingStats       `json:"pacing"`
+	Connections  ConnectionStats   `json:"connections"`
+	Phases       PhaseStats        `json:"phases"`
+	Traffic      TrafficStats      `json:"traffic"`
+	StatusCodes  map[string]int64  `json:"status_codes"`
+	ErrorClasses map[string]int64  `json:"error_classes"`
+	Assertions   map[string]int64  `json:"assertion_failures,omitempty"`
+	PerEndpoint  []EndpointStats   `json:"per_endpoint"`
+	Thresholds   []ThresholdResult `json:"thresholds,omitempty"`
+	Failed       bool              `json:"failed,omitempty"`
+	UsersCurve   []UsersPoint      `json:"users_curve,omitempty"`
+}
+
+// setCurrentRPSLocked changes the profile's current RPS and keeps a running
+// integral of it, so the average target RPS of a run can be reported next to
+// the achieved one. lt.mutex must be held.
+func (lt *LoadTester) setCurrentRPSLocked(rps int) {
+	now := time.Now()
+	lt.targetIntegral += float64(lt.state.CurrentRPS) * now.Sub(lt.targetSince).Seconds()
+	lt.targetSince = now
+	lt.state.CurrentRPS = rps
+}
+
+// buildSummaryLocked freezes the counters of the current run. lt.mutex must be
+// held.
+func (lt *LoadTester) buildSummaryLocked(endTime time.Time, reason string) *RunSummary {
+	s := &RunSummary{
+		StartTime:    lt.state.StartTime,
+		EndTime:      endTime,
+		DurationSec:  endTime.Sub(lt.state.StartTime).Seconds(),
+		StopReason:   reason,
+		TotalReqs:    lt.state.TotalReqs,
+		SuccessReqs:  lt.state.SuccessReqs,
+		ErrorReqs:    lt.state.ErrorReqs,
+		Latency:      lt.latency.Stats(),
+		Corrected:    lt.corrected.Stats(),
+		Pacing:       lt.pacingStats(),
+		Connections:  lt.client.stats(),
+		Phases:       lt.client.phaseStats(),
+		StatusCodes:  copyCounts(lt.state.StatusCodes),
+		ErrorClasses: copyCounts(lt.state.ErrorClasses),
+		Assertions:   copyCounts(lt.state.Assertions),
+	}
+	s.PerEndpoint = endpointStatsList(lt.endpointStats, s.DurationSec)
+	s.Traffic = lt.trafficStatsLocked(s.DurationSec)
+
+	if lt.config.Users != nil {
+		s.UsersCurve = usersCurve(lt.timeline.list())
+	}
+
+	if s.TotalReqs > 0 {
+		s.ErrorRate = float64(s.ErrorReqs) / float64(s.TotalReqs) * 100
+	}
+	if s.DurationSec > 0 {
+		s.TargetRPS = lt.targetIntegral / s.DurationSec
+		s.AchievedRPS = float64(s.TotalReqs) / s.DurationSec
+	}
+
+	s.Thresholds, s.Failed = finalThresholds(lt.state.Thresholds, thresholdInput{
+		latency:     s.Latency,
+		errorRate:   s.ErrorRate,
+		achievedRPS: s.AchievedRPS,
+		targetRPS:   s.TargetRPS,
+	})
+	return s
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultSpecPath is where flasgger serves the Swagger document of the
+	// app, next to the /apidocs UI.
+	defaultSpecPath  = "/apispec_1.json"
+	specFetchTimeout = 10 * time.Second
+	maxSpecBytes     = 10 << 20
+	// maxSchemaDepth stops sample generation of recursive schemas.
+	maxSchemaDepth = 8
+)
+
+// specMethods are the operation keys of a path item, in the order endpoints
+// are registered.
+var specMethods = []string{"get", "post", "put", "patch", "delete", "head", "options"}
+
+var pathParamPattern = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// SpecImportResult tells which operations of a spec became endpoints.
+type SpecImportResult struct {
+	Spec     string             `json:"spec"`
+	Imported []EndpointConfig   `json:"imported"`
+	Skipped  []SkippedOperation `json:"skipped,omitempty"`
+}
+
+type SkippedOperation struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// specGenerator turns the operations of a Swagger 2.0 or OpenAPI 3 document
+// into endpoints whose path, query, header and body templates produce sample
+// values of the declared schemas.
+type specGenerator struct {
+	doc map[string]interface{}
+}
+
+// specURL resolves where to fetch the spec from: spec may be a full URL, a
+// path on the target or empty for the flasgger default.
+func specURL(target, spec string) string {
+	if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		return spec
+	}
+	if spec == "" {
+		spec = defaultSpecPath
+	}
+	if target == "" {
+		target = getEnv("TARGET_URL", "http://localhost:8000")
+	}
+	return strings.TrimSuffix(target, "/") + "/" + strings.TrimPrefix(spec, "/")
+}
+
+func fetchSpec(specURL string) (map[string]interface{}, error) {
+	client := &http.Client{Timeout: specFetchTimeout}
+	req, err := http.NewRequest("GET", specURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "AnimalShelter-LoadTester/1.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", specURL, resp.Status)
+	}
+
+	var doc map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxSpecBytes)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%s is not a JSON spec: %w", specURL, err)
+	}
+	return doc, nil
+}
+
+// importSpec fetches the spec at specURL and registers its operations as
+// custom endpoints. Operations of built-in endpoints are left alone, custom
+// ones from an earlier import are replaced.
+func importSpec(specURL string) (*SpecImportResult, error) {
+	doc, err := fetchSpec(specURL)
+	if err != nil {
+		return nil, err
+	}
+	list, skipped, err := specEndpoints(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SpecImportResult{Spec: specURL, Imported: []EndpointConfig{}, Skipped: skipped}
+	for _, ep := range list {
+		registered, err := registerEndpoint(ep)
+		if err != nil {
+			result.Skipped = append(result.Skipped, SkippedOperation{Method: ep.Method, Path: ep.Path, Reason: err.Error()})
+			continue
+		}
+		result.Imported = append(result.Imported, registered)
+	}
+
+	log.Printf("📥 Imported %d endpoints from %s, skipped %d", len(result.Imported), specURL, len(result.Skipped))
+	return result, nil
+}
+
+// specEndpoints converts every operation of doc into an endpoint, sorted by
+// path. Operations that cannot be converted are returned as skipped.
+func specEndpoints(doc map[string]interface{}) ([]EndpointConfig, []SkippedOperation, error) {
+	base := ""
+	if version, _ := doc["swagger"].(string); version == "2.0" {
+		base, _ = doc["basePath"].(string)
+	} else if version, _ := doc["openapi"].(string); strings.HasPrefix(version, "3.") {
+		if servers, _ := doc["servers"].([]interface{}); len(servers) > 0 {
+			server, _ := servers[0].(map[string]interface{})
+			if u, err := url.Parse(fmt.Sprint(server["url"])); err == nil {
+				base = u.Path
+			}
+		}
+	} else {
+		return nil, nil, fmt.Errorf("not a Swagger 2.0 or OpenAPI 3 document")
+	}
+	base = strings.TrimSuffix(base, "/")
+
+	paths, _ := doc["paths"].(map[string]interface{})
+	keys := make([]string, 0, len(paths))
+	for path := range paths {
+		keys = append(keys, path)
+	}
+	sort.Strings(keys)
+
+	g := &specGenerator{doc: doc}
+	var list []EndpointConfig
+	var skipped []SkippedOperation
+	for _, path := range keys {
+		item, _ := g.resolve(paths[path]).(map[string]interface{})
+		for _, method := range specMethods {
+			op, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			ep, err := g.endpoint(strings.ToUpper(method), base+path, item, op)
+			if err != nil {
+				skipped = append(skipped, SkippedOperation{Method: strings.ToUpper(method), Path: base + path, Reason: err.Error()})
+				continue
+			}
+			list = append(list, ep)
+		}
+	}
+	return list, skipped, nil
+}
+
+func (g *specGenerator) endpoint(method, path string, item, op map[string]interface{}) (EndpointConfig, error) {
+	ep := EndpointConfig{Method: method, Path: path}
+	summary, _ := op["summary"].(string)
+	description, _ := op["description"].(string)
+	ep.Name = strings.TrimSpace(summary)
+	if ep.Name == "" {
+		ep.Name = method + " " + path
+	}
+	ep.Description = strings.TrimSpace(description)
+	if ep.Description == "" {
+		ep.Description = ep.Name
+	}
+	if deprecated, _ := op["deprecated"].(bool); deprecated {
+		ep.Description = strings.TrimSpace("[deprecated] " + ep.Description)
+	}
+
+	pathValues := make(map[string]string)
+	var form []string
+	for _, p := range g.parameters(item, op) {
+		name, _ := p["name"].(string)
+		in, _ := p["in"].(string)
+		required, _ := p["required"].(bool)
+		schema := p
+		if s, ok := p["schema"]; ok {
+			schema, _ = g.resolve(s).(map[string]interface{})
+		}
+
+		switch in {
+		case "path":
+			pathValues[name] = "{{pathEscape (" + g.scalar(schema) + ")}}"
+		case "query":
+			if required {
+				setTemplate(&ep.Query, name, "{{"+g.scalar(schema)+"}}")
+			}
+		case "header":
+			if required {
+				setTemplate(&ep.Headers, name, "{{"+g.scalar(schema)+"}}")
+			}
+		case "body":
+			ep.Body = g.jsonValue(schema, 0)
+		case "formData":
+			if required {
+				form = append(form, url.QueryEscape(name)+"={{urlquery ("+g.scalar(schema)+")}}")
+			}
+		}
+	}
+
+	if body, ok := g.resolve(op["requestBody"]).(map[string]interface{}); ok {
+		content, _ := body["content"].(map[string]interface{})
+		if media, ok := content["application/json"].(map[string]interface{}); ok {
+			schema, _ := g.resolve(media["schema"]).(map[string]interface{})
+			ep.Body = g.jsonValue(schema, 0)
+		}
+	}
+	if ep.Body == "" && len(form) > 0 {
+		ep.Body = strings.Join(form, "&")
+		setTemplate(&ep.Headers, "Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	// Path parameters the operation does not declare still need a value.
+	ep.Path = pathParamPattern.ReplaceAllStringFunc(ep.Path, func(param string) string {
+		if value, ok := pathValues[param[1:len(param)-1]]; ok {
+			return value
+		}
+		return "{{randInt 1 100}}"
+	})
+
+	if err := ep.compile(); err != nil {
+		return ep, err
+	}
+	return ep, nil
+}
+
+// parameters merges the path-level parameters of item with those of op, the
+// latter overriding the former by name and location.
+func (g *specGenerator) parameters(item, op map[string]interface{}) []map[string]interface{} {
+	var merged []map[string]interface{}
+	index := make(map[string]int)
+	for _, source := range []interface{}{item["parameters"], op["parameters"]} {
+		list, _ := source.([]interface{})
+		for _, raw := range list {
+			p, ok := g.resolve(raw).(map[string]interface{})
+			if !ok {
+				continue
+			}
+			key := fmt.Sprint(p["in"]) + " " + fmt.Sprint(p["name"])
+			if i, ok := index[key]; ok {
+				merged[i] = p
+				continue
+			}
+			index[key] = len(merged)
+			merged = append(merged, p)
+		}
+	}
+	return merged
+}
+
+func setTemplate(m *map[string]string, key, value string) {
+	if *m == nil {
+		*m = make(map[string]string)
+	}
+	(*m)[key] = value
+}
+
+// resolve follows local $ref pointers such as #/definitions/Animal.
+func (g *specGenerator) resolve(v interface{}) interface{} {
+	for i := 0; i < maxSchemaDepth; i++ {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return v
+		}
+		if !strings.HasPrefix(ref, "#/") {
+			return nil
+		}
+		var target interface{} = g.doc
+		for _, part := range strings.Split(ref[2:], "/") {
+			part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+			node, _ := target.(map[string]interface{})
+			target = node[part]
+		}
+		v = target
+	}
+	return nil
+}
+
+// merged flattens allOf into one schema and picks the first alternative of
+// oneOf and anyOf.
+func (g *specGenerator) merged(schema map[string]interface{}, depth int) map[string]interface{} {
+	if depth > maxSchemaDepth {
+		return schema
+	}
+	if alternatives, _ := schema["oneOf"].([]interface{}); len(alternatives) > 0 {
+		if first, ok := g.resolve(alternatives[0]).(map[string]interface{}); ok {
+			return g.merged(first, depth+1)
+		}
+	}
+	if alternatives, _ := schema["anyOf"].([]interface{}); len(alternatives) > 0 {
+		if first, ok := g.resolve(alternatives[0]).(map[string]interface{}); ok {
+			return g.merged(first, depth+1)
+		}
+	}
+	parts, _ := schema["allOf"].([]interface{})
+	if len(parts) == 0 {
+		return schema
+	}
+
+	result := make(map[string]interface{}, len(schema))
+	properties := make(map[string]interface{})
+	for i := 0; i <= len(parts); i++ {
+		part := schema
+		if i < len(parts) {
+			resolved, ok := g.resolve(parts[i]).(map[string]interface{})
+			if !ok {
+				continue
+			}
+			part = g.merged(resolved, depth+1)
+		}
+		for k, v := range part {
+			if k == "properties" {
+				props, _ := v.(map[string]interface{})
+				for name, prop := range props {
+					properties[name] = prop
+				}
+				continue
+			}
+			if k != "allOf" {
+				result[k] = v
+			}
+		}
+	}
+	if len(properties) > 0 {
+		result["properties"] = properties
+	}
+	return result
+}
+
+func schemaType(schema map[string]interface{}) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, v := range t {
+			if s, ok := v.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	if _, ok := schema["properties"]; ok {
+		return "object"
+	}
+	if _, ok := schema["items"]; ok {
+		return "array"
+	}
+	return "string"
+}
+
+// sampleLiteral returns the value the schema itself suggests, if any.
+func sampleLiteral(schema map[string]interface{}) (interface{}, bool) {
+	for _, key := range []string{"example", "x-example", "default", "const"} {
+		if v, ok := schema[key]; ok {
+			return v, true
+		}
+	}
+	if examples, _ := schema["examples"].([]interface{}); len(examples) > 0 {
+		return examples[0], true
+	}
+	return nil, false
+}
+
+// jsonValue returns a template rendering a JSON sample of schema.
+func (g *specGenerator) jsonValue(schema map[string]interface{}, depth int) string {
+	if schema == nil {
+		return "null"
+	}
+	schema = g.merged(schema, depth)
+	if v, ok := sampleLiteral(schema); ok {
+		b, _ := json.Marshal(v)
+		return templateText(string(b))
+	}
+	if enum, _ := schema["enum"].([]interface{}); len(enum) > 0 {
+		return "{{json (pick " + templateConstants(enum) + ")}}"
+	}
+
+	switch schemaType(schema) {
+	case "object":
+		if depth >= maxSchemaDepth {
+			return "{}"
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(properties))
+		for name := range properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fields := make([]string, 0, len(names))
+		for _, name := range names {
+			prop, _ := g.resolve(properties[name]).(map[string]interface{})
+			key, _ := json.Marshal(name)
+			fields = append(fields, templateText(string(key))+": "+g.jsonValue(prop, depth+1))
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	case "array":
+		if depth >= maxSchemaDepth {
+			return "[]"
+		}
+		items, _ := g.resolve(schema["items"]).(map[string]interface{})
+		return "[" + g.jsonValue(items, depth+1) + "]"
+	case "integer", "number", "boolean":
+		return "{{" + g.scalar(schema) + "}}"
+	case "null":
+		return "null"
+	default:
+		// Generated strings are letters, digits and punctuation that need
+		// no JSON escaping.
+		return `"{{` + g.scalar(schema) + `}}"`
+	}
+}
+
+// scalar returns a template pipeline producing a sample of a scalar schema,
+// for use in paths, query strings, headers and form fields.
+func (g *specGenerator) scalar(schema map[string]interface{}) string {
+	if schema == nil {
+		return `""`
+	}
+	schema = g.merged(schema, 0)
+	if v, ok := sampleLiteral(schema); ok {
+		return templateConstant(v)
+	}
+	if enum, _ := schema["enum"].([]interface{}); len(enum) > 0 {
+		return "pick " + templateConstants(enum)
+	}
+
+	switch schemaType(schema) {
+	case "integer":
+		lo, hi := numericRange(schema, 1)
+		return fmt.Sprintf("randInt %d %d", sampleInt(lo), sampleInt(hi))
+	case "number":
+		lo, hi := numericRange(schema, 0)
+		return "randFloat " + formatNumber(lo) + " " + formatNumber(hi)
+	case "boolean":
+		return "pick true false"
+	case "array":
+		items, _ := g.resolve(schema["items"]).(map[string]interface{})
+		if items == nil || schemaType(items) == "array" || schemaType(items) == "object" {
+			return `""`
+		}
+		return g.scalar(items)
+	case "object", "null":
+		return `""`
+	}
+
+	format, _ := schema["format"].(string)
+	switch format {
+	case "date-time":
+		return "now"
+	case "date":
+		return `printf "%d-%02d-%02d" (randInt 2020 2025) (randInt 1 12) (randInt 1 28)`
+	case "uuid":
+		return "uuid"
+	case "email":
+		return `printf "%s@example.com" (randString 8)`
+	}
+	n := 8
+	if min, ok := schema["minLength"].(float64); ok && int(min) > n {
+		n = int(min)
+	}
+	if max, ok := schema["maxLength"].(float64); ok && int(max) < n && max > 0 {
+		n = int(max)
+	}
+	return fmt.Sprintf("randString %d", n)
+}
+
+// numericRange is the sample range of a numeric schema: its bounds, or 1..100
+// around whichever bound is declared. step is the smallest value difference,
+// used to honor exclusive bounds.
+func numericRange(schema map[string]interface{}, step float64) (float64, float64) {
+	lo, hasLo := schema["minimum"].(float64)
+	hi, hasHi := schema["maximum"].(float64)
+	// Swagger 2.0 and OpenAPI 3.0 mark exclusive bounds with a boolean,
+	// OpenAPI 3.1 gives the bound itself.
+	if v, ok := schema["exclusiveMinimum"].(float64); ok {
+		lo, hasLo = v+step, true
+	} else if exclusive, _ := schema["exclusiveMinimum"].(bool); exclusive && hasLo {
+		lo += step
+	}
+	if v, ok := schema["exclusiveMaximum"].(float64); ok {
+		hi, hasHi = v-step, true
+	} else if exclusive, _ := schema["exclusiveMaximum"].(bool); exclusive && hasHi {
+		hi -= step
+	}
+
+	switch {
+	case hasLo && hasHi:
+	case hasLo:
+		hi = lo + 99
+	case hasHi:
+		lo = hi - 99
+	default:
+		lo, hi = 1, 100
+	}
+	if hi < lo {
+		hi = lo
+	}
+	return lo, hi
+}
+
+// sampleInt converts a bound of an integer schema for randInt, clamped so
+// that the whole range between two bounds still fits an int64.
+func sampleInt(f float64) int64 {
+	const limit = 1<<62 - 1
+	switch {
+	case f >= limit:
+		return limit
+	case f <= -limit:
+		return -limit
+	}
+	return int64(f)
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// templateConstant writes v as a constant of a template pipeline.
+func templateConstant(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return formatNumber(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return `""`
+	default:
+		b, _ := json.Marshal(v)
+		return strconv.Quote(string(b))
+	}
+}
+
+func templateConstants(values []interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = templateConstant(v)
+	}
+	return strings.Join(parts, " ")
+}
+
+// templateText makes literal text safe to embed in a template.
+func templateText(s string) string {
+	if strings.Contains(s, "{{") {
+		return "{{" + strconv.Quote(s) + "}}"
+	}
+	return s
+}
+
+func importEndpointsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Target string `json:"target"`
+		Spec   string `json:"spec"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := importSpec(specURL(req.Target, req.Spec))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to import spec: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testSwaggerSpec = `{
+	"swagger": "2.0",
+	"basePath": "/v1/",
+	"definitions": {
+		"Animal": {
+			"type": "object",
+			"required": ["name"],
+			"properties": {
+				"name": {"type": "string", "example": "Барсик"},
+				"age": {"type": "integer", "minimum": 1, "maximum": 15},
+				"tags": {"type": "array", "items": {"type": "string", "enum": ["cat", "dog"]}}
+			}
+		}
+	},
+	"paths": {
+		"/animals": {
+			"get": {
+				"summary": "List animals",
+				"parameters": [
+					{"in": "query", "name": "limit", "type": "integer", "required": true, "minimum": 0, "maximum": 9223372036854775807},
+					{"in": "query", "name": "offset", "type": "integer"}
+				]
+			},
+			"post": {
+				"summary": "Add an animal",
+				"parameters": [{"in": "body", "name": "animal", "schema": {"$ref": "#/definitions/Animal"}}]
+			}
+		},
+		"/animals/{kind}/{id}": {
+			"parameters": [{"in": "path", "name": "kind", "type": "string", "enum": ["a/b", "c d?"]}],
+			"get": {
+				"deprecated": true,
+				"parameters": [{"in": "path", "name": "id", "type": "integer", "minimum": 5, "maximum": 5}]
+			}
+		},
+		"/login": {
+			"post": {
+				"summary": "Log in",
+				"parameters": [
+					{"in": "formData", "name": "user", "type": "string", "required": true, "example": "a b&c"},
+					{"in": "header", "name": "X-Trace", "type": "string", "required": true, "default": "t-1"}
+				]
+			}
+		}
+	}
+}`
+
+func specRequest(t *testing.T, ep EndpointConfig) *http.Request {
+	t.Helper()
+	req, err := ep.newRequest(context.Background(), "http://target", nil)
+	if err != nil {
+		t.Fatalf("%s %s: %v", ep.Method, ep.Path, err)
+	}
+	return req
+}
+
+func TestSpecEndpoints(t *testing.T) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(testSwaggerSpec), &doc); err != nil {
+		t.Fatal(err)
+	}
+	list, skipped, err := specEndpoints(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 0 {
+		t.Errorf("skipped %+v", skipped)
+	}
+
+	var keys []string
+	byKey := make(map[string]EndpointConfig)
+	for _, ep := range list {
+		keys = append(keys, ep.Key())
+		byKey[ep.Key()] = ep
+	}
+	want := "GET /v1/animals,POST /v1/animals,GET /v1/animals/{{pathEscape (pick \"a/b\" \"c d?\")}}/{{pathEscape (randInt 5 5)}},POST /v1/login"
+	if got := strings.Join(keys, ","); got != want {
+		t.Fatalf("endpoints\n got %s\nwant %s", got, want)
+	}
+
+	// Required query parameters only, with an int64 maximum clamped to a
+	// range randInt can draw from.
+	req := specRequest(t, byKey["GET /v1/animals"])
+	if q := req.URL.Query(); q.Get("limit") == "" || strings.HasPrefix(q.Get("limit"), "-") || q.Has("offset") {
+		t.Errorf("query %s", req.URL.RawQuery)
+	}
+	if ep := byKey["GET /v1/animals"]; ep.Name != "List animals" || ep.Query["limit"] != "{{randInt 0 4611686018427387903}}" {
+		t.Errorf("list endpoint %+v", ep)
+	}
+
+	// Path values are escaped, so they stay one segment each.
+	ep := byKey[keys[2]]
+	if !strings.HasPrefix(ep.Description, "[deprecated]") {
+		t.Errorf("description %q", ep.Description)
+	}
+	for i := 0; i < 20; i++ {
+		path := specRequest(t, ep).URL.EscapedPath()
+		if path != "/v1/animals/a%2Fb/5" && path != "/v1/animals/c%20d%3F/5" {
+			t.Fatalf("path %s", path)
+		}
+	}
+
+	// The body follows the referenced schema.
+	var animal struct {
+		Name string   `json:"name"`
+		Age  int      `json:"age"`
+		Tags []string `json:"tags"`
+	}
+	req = specRequest(t, byKey["POST /v1/animals"])
+	if err := json.NewDecoder(req.Body).Decode(&animal); err != nil {
+		t.Fatal(err)
+	}
+	if animal.Name != "Барсик" || animal.Age < 1 || animal.Age > 15 || len(animal.Tags) != 1 {
+		t.Errorf("body %+v", animal)
+	}
+
+	// Form fields are encoded, headers kept.
+	req = specRequest(t, byKey["POST /v1/login"])
+	if err := req.ParseForm(); err != nil {
+		t.Fatal(err)
+	}
+	if req.PostForm.Get("user") != "a b&c" || req.Header.Get("X-Trace") != "t-1" {
+		t.Errorf("form %v, header %q", req.PostForm, req.Header.Get("X-Trace"))
+	}
+}
+
+func TestSpecEndpointsOpenAPI3(t *testing.T) {
+	var doc map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"openapi": "3.0.1",
+		"servers": [{"url": "https://api.example.com/shelter"}],
+		"paths": {"/pets": {"put": {"requestBody": {"content": {"application/json": {"schema": {
+			"type": "object", "properties": {"id": {"type": "integer", "exclusiveMinimum": true, "minimum": 0, "maximum": 3}}
+		}}}}}}}
+	}`), &doc)
+
+	list, _, err := specEndpoints(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Key() != "PUT /shelter/pets" || list[0].Body != `{"id": {{randInt 1 3}}}` {
+		t.Fatalf("%+v", list)
+	}
+
+	if _, _, err := specEndpoints(map[string]interface{}{"swagger": "1.2"}); err == nil {
+		t.Error("Swagger 1.2 accepted")
+	}
+}
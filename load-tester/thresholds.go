@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	thresholdRPSRatio = "rps_ratio"
+)
+
+// thresholdMetrics lists the metrics a threshold can be set on. Latencies are
+// in milliseconds, error_rate in percent and rps_ratio is achieved RPS divided
+// by target RPS.
+var thresholdMetrics = map[string]bool{
+	"p50_ms":          true,
+	"p90_ms":          true,
+	"p95_ms":          true,
+	"p99_ms":          true,
+	"p999_ms":         true,
+	"max_ms":          true,
+	"mean_ms":         true,
+	"error_rate":      true,
+	"achieved_rps":    true,
+	thresholdRPSRatio: true,
+}
+
+var thresholdAliases = map[string]string{
+	"p50":    "p50_ms",
+	"p90":    "p90_ms",
+	"p95":    "p95_ms",
+	"p99":    "p99_ms",
+	"p999":   "p999_ms",
+	"max":    "max_ms",
+	"mean":   "mean_ms",
+	"errors": "error_rate",
+	"rps":    "achieved_rps",
+}
+
+var thresholdExpr = regexp.MustCompile(`^(\w+)\s*(<=|>=|<|>)\s*([0-9]*\.?[0-9]+)\s*(ms|s|%)?\s*(\*\s*target)?(?:\s+abort\s+(?:after\s+)?([0-9]*\.?[0-9]+)\s*s?)?$`)
+
+// Threshold is a pass/fail condition on a run metric, e.g. p95_ms < 300. It
+// can be given as an expression such as "p95 < 300ms", "error_rate < 1%" or
+// "achieved_rps >= 0.95 * target", optionally followed by "abort 10s" to stop
+// the run once the condition has been breached for that many seconds in a row.
+type Threshold struct {
+	Expr          string  `json:"expr,omitempty"`
+	Metric        string  `json:"metric"`
+	Op            string  `json:"op"`
+	Value         float64 `json:"value"`
+	AbortAfterSec float64 `json:"abort_after_sec,omitempty"`
+}
+
+type ThresholdResult struct {
+	Threshold
+	Actual      float64 `json:"actual"`
+	Passed      bool    `json:"passed"`
+	BreachedSec int     `json:"breached_sec,omitempty"`
+	Aborted     bool    `json:"aborted,omitempty"`
+}
+
+// thresholdInput holds the values thresholds are checked against: those of a
+// single second while the run is going, and of the whole run at its end.
+type thresholdInput struct {
+	latency     LatencyStats
+	errorRate   float64
+	achievedRPS float64
+	targetRPS   float64
+}
+
+func parseThreshold(expr string) (Threshold, error) {
+	m := thresholdExpr.FindStringSubmatch(strings.TrimSpace(expr))
+	if m == nil {
+		return Threshold{}, fmt.Errorf("threshold %q must look like \"p95 < 300ms\" or \"achieved_rps >= 0.95 * target\"", expr)
+	}
+
+	t := Threshold{Expr: strings.TrimSpace(expr), Metric: strings.ToLower(m[1]), Op: m[2]}
+	if alias, ok := thresholdAliases[t.Metric]; ok {
+		t.Metric = alias
+	}
+	t.Value, _ = strconv.ParseFloat(m[3], 64)
+
+	latency := strings.HasSuffix(t.Metric, "_ms")
+	switch unit := m[4]; {
+	case (unit == "ms" || unit == "s") && !latency:
+		return Threshold{}, fmt.Errorf("threshold %q: %s is not a latency", expr, t.Metric)
+	case unit == "%" && t.Metric != "error_rate":
+		return Threshold{}, fmt.Errorf("threshold %q: only error_rate is a percentage", expr)
+	case unit == "s":
+		t.Value *= 1000
+	}
+
+	if m[5] != "" {
+		if t.Metric != "achieved_rps" {
+			return Threshold{}, fmt.Errorf("threshold %q: only achieved_rps can be relative to target", expr)
+		}
+		t.Metric = thresholdRPSRatio
+	}
+	if m[6] != "" {
+		t.AbortAfterSec, _ = strconv.ParseFloat(m[6], 64)
+	}
+	return t, nil
+}
+
+// validateThresholds parses the expressions of list in place and checks the
+// resulting conditions.
+func validateThresholds(list []Threshold) error {
+	for i := range list {
+		t := &list[i]
+		if t.Expr != "" && t.Metric == "" {
+			parsed, err := parseThreshold(t.Expr)
+			if err != nil {
+				return err
+			}
+			if t.AbortAfterSec > 0 {
+				parsed.AbortAfterSec = t.AbortAfterSec
+			}
+			*t = parsed
+		}
+
+		if !thresholdMetrics[t.Metric] {
+			return fmt.Errorf("threshold %d: unknown metric %q", i+1, t.Metric)
+		}
+		switch t.Op {
+		case "<", "<=", ">", ">=":
+		default:
+			return fmt.Errorf("threshold %d: unknown operator %q", i+1, t.Op)
+		}
+		if t.Value < 0 || t.AbortAfterSec < 0 {
+			return fmt.Errorf("threshold %d: value and abort_after_sec must not be negative", i+1)
+		}
+		if t.Expr == "" {
+			t.Expr = t.String()
+		}
+	}
+	return nil
+}
+
+func (t Threshold) String() string {
+	s := fmt.Sprintf("%s %s %g", t.Metric, t.Op, t.Value)
+	if t.AbortAfterSec > 0 {
+		s += fmt.Sprintf(" abort %gs", t.AbortAfterSec)
+	}
+	return s
+}
+
+func (t Threshold) holds(actual float64) bool {
+	switch t.Op {
+	case "<":
+		return actual < t.Value
+	case "<=":
+		return actual <= t.Value
+	case ">":
+		return actual > t.Value
+	default:
+		return actual >= t.Value
+	}
+}
+
+// value returns the metric's value, or false when there is nothing to judge
+// it by yet, e.g. no request has completed.
+func (in thresholdInput) value(metric string) (float64, bool) {
+	switch metric {
+	case "achieved_rps":
+		return in.achievedRPS, true
+	case thresholdRPSRatio:
+		if in.targetRPS <= 0 {
+			return 0, false
+		}
+		return in.achievedRPS / in.targetRPS, true
+	}
+
+	if in.latency.Count == 0 {
+		return 0, false
+	}
+	switch metric {
+	case "error_rate":
+		return in.errorRate, true
+	case "p50_ms":
+		return in.latency.P50, true
+	case "p90_ms":
+		return in.latency.P90, true
+	case "p95_ms":
+		return in.latency.P95, true
+	case "p99_ms":
+		return in.latency.P99, true
+	case "p999_ms":
+		return in.latency.P999, true
+	case "max_ms":
+		return in.latency.Max, true
+	default:
+		return in.latency.Mean, true
+	}
+}
+
+func newThresholdResults(list []Threshold) []ThresholdResult {
+	results := make([]ThresholdResult, len(list))
+	for i, t := range list {
+		results[i] = ThresholdResult{Threshold: t, Passed: true}
+	}
+	return results
+}
+
+// checkThresholdsLocked evaluates the run's thresholds against one second of
+// the run and aborts it when a threshold with abort_after_sec has been
+// breached long enough. lt.mutex must be held.
+func (lt *LoadTester) checkThresholdsLocked(ctx context.Context, in thresholdInput) {
+	for i := range lt.state.Thresholds {
+		r := &lt.state.Thresholds[i]
+		actual, ok := in.value(r.Metric)
+		if !ok {
+			continue
+		}
+
+		r.Actual = actual
+		r.Passed = r.holds(actual)
+		if r.Passed {
+			r.BreachedSec = 0
+			continue
+		}
+		r.BreachedSec++
+		if r.BreachedSec == 1 {
+			events.publish(eventThresholdBreached, ThresholdBreachedEvent{RunID: lt.state.RunID, Expr: r.Expr, Actual: actual})
+		}
+
+		if r.AbortAfterSec > 0 && float64(r.BreachedSec) >= r.AbortAfterSec && !r.Aborted {
+			r.Aborted = true
+			log.Printf("🚨 Threshold %q breached for %ds (actual %.2f), aborting run %s",
+				r.Expr, r.BreachedSec, actual, lt.state.RunID)
+			lt.stopLater(ctx, stopReasonThreshold)
+		}
+	}
+}
+
+// finalThresholds checks thresholds against the whole run. A threshold that
+// aborted the run fails regardless of the final value.
+func finalThresholds(live []ThresholdResult, in thresholdInput) ([]ThresholdResult, bool) {
+	if len(live) == 0 {
+		return nil, false
+	}
+
+	failed := false
+	results := make([]ThresholdResult, len(live))
+	for i, r := range live {
+		result := ThresholdResult{Threshold: r.Threshold, Aborted: r.Aborted, Passed: true}
+		if actual, ok := in.value(r.Metric); ok {
+			result.Actual = actual
+			result.Passed = r.holds(actual)
+		}
+		if r.Aborted {
+			result.Passed = false
+		}
+		if !result.Passed {
+			failed = true
+		}
+		results[i] = result
+	}
+	return results, failed
+}
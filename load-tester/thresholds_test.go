@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseThreshold(t *testing.T) {
+	tests := map[string]Threshold{
+		"p95 < 300ms":                   {Metric: "p95_ms", Op: "<", Value: 300},
+		"p99_ms<=1.5s":                  {Metric: "p99_ms", Op: "<=", Value: 1500},
+		"P999 < 2s":                     {Metric: "p999_ms", Op: "<", Value: 2000},
+		"mean < 50":                     {Metric: "mean_ms", Op: "<", Value: 50},
+		"error_rate < 1%":               {Metric: "error_rate", Op: "<", Value: 1},
+		"errors < .5%":                  {Metric: "error_rate", Op: "<", Value: 0.5},
+		"rps > 100":                     {Metric: "achieved_rps", Op: ">", Value: 100},
+		"achieved_rps >= 0.95 * target": {Metric: thresholdRPSRatio, Op: ">=", Value: 0.95},
+		"p95 < 300ms abort 10s":         {Metric: "p95_ms", Op: "<", Value: 300, AbortAfterSec: 10},
+		"error_rate < 5% abort after 3": {Metric: "error_rate", Op: "<", Value: 5, AbortAfterSec: 3},
+	}
+	for expr, want := range tests {
+		t.Run(expr, func(t *testing.T) {
+			got, err := parseThreshold(expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want.Expr = expr
+			if got != want {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseThresholdErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"p95",
+		"p95 = 300ms",
+		"p95 < fast",
+		"error_rate < 1ms",
+		"p95 < 5%",
+		"p95 < 300ms * target",
+		"rps > 10 abort",
+		"p95 < -1ms",
+	} {
+		if _, err := parseThreshold(expr); err == nil {
+			t.Errorf("parseThreshold(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestValidateThresholds(t *testing.T) {
+	list := []Threshold{
+		{Expr: " p95 < 300ms ", AbortAfterSec: 5},
+		{Metric: "error_rate", Op: "<", Value: 2},
+	}
+	if err := validateThresholds(list); err != nil {
+		t.Fatal(err)
+	}
+	if list[0].Metric != "p95_ms" || list[0].Expr != "p95 < 300ms" || list[0].AbortAfterSec != 5 {
+		t.Errorf("expression not parsed in place: %+v", list[0])
+	}
+	if list[1].Expr != "error_rate < 2" {
+		t.Errorf("expression not filled in: %q", list[1].Expr)
+	}
+
+	for _, bad := range []Threshold{
+		{Metric: "p42_ms", Op: "<", Value: 1},
+		{Metric: "p95_ms", Op: "=", Value: 1},
+		{Metric: "p95_ms", Op: "<", Value: -1},
+		{Expr: "p95 <"},
+	} {
+		if err := validateThresholds([]Threshold{bad}); err == nil {
+			t.Errorf("validateThresholds(%+v) succeeded", bad)
+		}
+	}
+}
+
+func TestThresholdInputValue(t *testing.T) {
+	in := thresholdInput{
+		latency:     LatencyStats{Count: 10, P95: 120, Mean: 80},
+		errorRate:   2,
+		achievedRPS: 90,
+		targetRPS:   100,
+	}
+	if v, ok := in.value(thresholdRPSRatio); !ok || v != 0.9 {
+		t.Errorf("rps_ratio %g, %v", v, ok)
+	}
+	if v, ok := in.value("p95_ms"); !ok || v != 120 {
+		t.Errorf("p95_ms %g, %v", v, ok)
+	}
+	if v, ok := in.value("mean_ms"); !ok || v != 80 {
+		t.Errorf("mean_ms %g, %v", v, ok)
+	}
+
+	if _, ok := (thresholdInput{achievedRPS: 5}).value(thresholdRPSRatio); ok {
+		t.Error("rps_ratio judged without a target")
+	}
+	if _, ok := (thresholdInput{}).value("error_rate"); ok {
+		t.Error("error_rate judged without requests")
+	}
+}
+
+func TestCheckThresholdsAborts(t *testing.T) {
+	lt := newLoadTester()
+	lt.state.Thresholds = newThresholdResults([]Threshold{
+		{Expr: "p95 < 100ms abort 3s", Metric: "p95_ms", Op: "<", Value: 100, AbortAfterSec: 3},
+	})
+	slow := thresholdInput{latency: LatencyStats{Count: 1, P95: 150}}
+	fast := thresholdInput{latency: LatencyStats{Count: 1, P95: 50}}
+
+	// Breaches must be consecutive: a good second starts the count again.
+	for _, in := range []thresholdInput{slow, slow, fast, slow, slow} {
+		lt.checkThresholdsLocked(context.Background(), in)
+	}
+	if r := lt.state.Thresholds[0]; r.Passed || r.BreachedSec != 2 || r.Aborted {
+		t.Fatalf("after a break in the breach: %+v", r)
+	}
+
+	lt.checkThresholdsLocked(context.Background(), slow)
+	if r := lt.state.Thresholds[0]; !r.Aborted || r.Actual != 150 {
+		t.Errorf("after 3s of breach: %+v", r)
+	}
+}
+
+func TestFinalThresholds(t *testing.T) {
+	live := newThresholdResults([]Threshold{
+		{Metric: "p95_ms", Op: "<", Value: 100},
+		{Metric: "error_rate", Op: "<", Value: 1},
+	})
+	in := thresholdInput{latency: LatencyStats{Count: 10, P95: 80}, errorRate: 0.5}
+
+	results, failed := finalThresholds(live, in)
+	if failed || !results[0].Passed || !results[1].Passed {
+		t.Errorf("passing run failed: %+v", results)
+	}
+
+	live[0].Aborted = true
+	if results, failed = finalThresholds(live, in); !failed || results[0].Passed {
+		t.Errorf("aborted threshold passed: %+v", results)
+	}
+
+	if results, failed = finalThresholds(nil, in); results != nil || failed {
+		t.Error("run without thresholds failed")
+	}
+}
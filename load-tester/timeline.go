@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// timelineCapacity is how many per-second samples a run keeps: a day's
+// worth. Longer runs keep their last day.
+const timelineCapacity = 24 * 3600
+
+// sampleRing holds the per-second samples of the current run in a fixed-size
+// ring buffer, so that a run left going for days does not grow without bound.
+type sampleRing struct {
+	samples []TimelineSample
+	start   int
+}
+
+type TimelineResponse struct {
+	RunID   string           `json:"run_id,omitempty"`
+	Running bool             `json:"running"`
+	Samples []TimelineSample `json:"samples"`
+	Events  []TimelineEvent  `json:"events,omitempty"`
+}
+
+// SampleEvent is the /events message carrying each new timeline sample.
+type SampleEvent struct {
+	RunID string `json:"run_id"`
+	TimelineSample
+}
+
+func (r *sampleRing) push(s TimelineSample) {
+	if len(r.samples) < timelineCapacity {
+		r.samples = append(r.samples, s)
+		return
+	}
+	r.samples[r.start] = s
+	r.start = (r.start + 1) % len(r.samples)
+}
+
+// since returns, oldest first, the samples taken after elapsed seconds of the
+// run; since(-1) returns all of them.
+func (r *sampleRing) since(elapsed float64) []TimelineSample {
+	result := make([]TimelineSample, 0, len(r.samples))
+	for i := range r.samples {
+		s := r.samples[(r.start+i)%len(r.samples)]
+		if s.Elapsed > elapsed {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func (r *sampleRing) list() []TimelineSample {
+	return r.since(-1)
+}
+
+func (r *sampleRing) reset() {
+	r.samples = nil
+	r.start = 0
+}
+
+// timelineHandler returns the per-second samples of the current or last run.
+// ?since=<seconds> returns only samples newer than that, for incremental
+// polling.
+func timelineHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	since := -1.0
+	if v := r.URL.Query().Get("since"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			http.Error(w, "Invalid since", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	loadTester.mutex.RLock()
+	data := TimelineResponse{
+		RunID:   loadTester.state.RunID,
+		Running: loadTester.state.Running,
+		Samples: loadTester.timeline.since(since),
+		Events:  loadTester.state.Events,
+	}
+	loadTester.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+// chartScript draws timelines on canvases without any charting library. It
+// is shared by the live page and the run history.
+const chartScript = `
+        const chartDefs = [
+            {
+                key: 'rps', title: '📈 RPS: цель и факт', unit: '',
+                series: [
+                    { label: 'цель', color: '#6c757d', value: function (p) { return p.target_rps; }, optional: true },
+                    { label: 'факт', color: '#28a745', value: function (p) { return p.achieved_rps; } }
+                ]
+            },
+            {
+                key: 'latency', title: '⏱️ Задержка', unit: ' мс',
+                series: [
+                    { label: 'p50', color: '#007bff', value: function (p) { return p.p50_ms; } },
+                    { label: 'p95', color: '#fd7e14', value: function (p) { return p.p95_ms; } },
+                    { label: 'p99', color: '#dc3545', value: function (p) { return p.p99_ms; } }
+                ]
+            },
+            {
+                key: 'traffic', title: '📦 Трафик', unit: ' МБ/с',
+                series: [
+                    { label: 'получено', color: '#17a2b8', value: function (p) { return (p.recv_bytes || 0) / 1e6; } },
+                    { label: 'отправлено', color: '#6f42c1', value: function (p) { return (p.sent_bytes || 0) / 1e6; } }
+                ]
+            },
+            {
+                key: 'payload', title: '📄 Средний размер ответа', unit: ' КБ',
+                series: [
+                    { label: 'ответ', color: '#20c997', value: function (p) {
+                        return p.achieved_rps > 0 ? (p.recv_bytes || 0) / p.achieved_rps / 1000 : 0;
+                    } }
+                ]
+            },
+            {
+                key: 'errors', title: '❌ Доля ошибок', unit: '%',
+                series: [
+                    { label: 'ошибки', color: '#dc3545', value: function (p) {
+                        return p.achieved_rps > 0 ? p.errors / p.achieved_rps * 100 : 0;
+                    } }
+                ]
+            }
+        ];
+
+        const changeNames = { rps: 'RPS', users: 'Пользователи', profile: 'Профиль', mix: 'Эндпоинты' };
+
+        function escapeHTML(text) {
+            const div = document.createElement('div');
+            div.textContent = text;
+            return div.innerHTML;
+        }
+
+        function describeChange(change) {
+            return (changeNames[change.type] || change.type) + ': ' + escapeHTML(change.from) + ' → ' + escapeHTML(change.to);
+        }
+
+        function formatBytes(bytes) {
+            if (bytes >= 1e6) return (bytes / 1e6).toFixed(2) + ' МБ';
+            if (bytes >= 1e3) return (bytes / 1e3).toFixed(1) + ' КБ';
+            return bytes.toFixed(0) + ' Б';
+        }
+
+        function formatAxis(value) {
+            if (value >= 1000) return (value / 1000).toFixed(1) + 'k';
+            if (value >= 10) return value.toFixed(0);
+            return value >= 1 ? value.toFixed(1) : value.toFixed(2);
+        }
+
+        function drawChart(canvas, samples, def, changes) {
+            const ratio = window.devicePixelRatio || 1;
+            const width = canvas.clientWidth;
+            const height = canvas.clientHeight;
+            canvas.width = width * ratio;
+            canvas.height = height * ratio;
+
+            const ctx = canvas.getContext('2d');
+            ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+            ctx.clearRect(0, 0, width, height);
+
+            const pad = { left: 48, right: 10, top: 10, bottom: 20 };
+            const plotW = width - pad.left - pad.right;
+            const plotH = height - pad.top - pad.bottom;
+
+            let maxY = 0;
+            samples.forEach(function (p) {
+                def.series.forEach(function (s) { maxY = Math.max(maxY, s.value(p)); });
+            });
+            maxY = maxY > 0 ? maxY * 1.1 : 1;
+            const minT = samples.length > 0 ? samples[0].t : 0;
+            const maxT = samples.length > 1 ? samples[samples.length - 1].t : minT + 1;
+
+            ctx.font = '11px sans-serif';
+            ctx.lineWidth = 1;
+            for (let i = 0; i <= 4; i++) {
+                const y = pad.top + plotH * i / 4;
+                ctx.strokeStyle = '#e9ecef';
+                ctx.beginPath();
+                ctx.moveTo(pad.left, y);
+                ctx.lineTo(width - pad.right, y);
+                ctx.stroke();
+                ctx.fillStyle = '#6c757d';
+                ctx.fillText(formatAxis(maxY * (4 - i) / 4) + def.unit, 2, y + 4);
+            }
+            ctx.fillText(minT.toFixed(0) + 's', pad.left, height - 4);
+            ctx.fillText(maxT.toFixed(0) + 's', width - pad.right - 30, height - 4);
+
+            // Changes made to the run while it was going, as dashed markers.
+            ctx.strokeStyle = '#6f42c1';
+            ctx.setLineDash([4, 3]);
+            (changes || []).forEach(function (change) {
+                if (change.t < minT || change.t > maxT) return;
+                const x = pad.left + (change.t - minT) / (maxT - minT) * plotW;
+                ctx.beginPath();
+                ctx.moveTo(x, pad.top);
+                ctx.lineTo(x, pad.top + plotH);
+                ctx.stroke();
+            });
+            ctx.setLineDash([]);
+
+            ctx.lineWidth = 2;
+            def.series.forEach(function (s) {
+                // Optional series, like the target of a virtual users run,
+                // are left out when they have no data.
+                if (s.optional && samples.every(function (p) { return !s.value(p); })) return;
+                ctx.strokeStyle = s.color;
+                ctx.beginPath();
+                samples.forEach(function (p, i) {
+                    const x = pad.left + (p.t - minT) / (maxT - minT) * plotW;
+                    const y = pad.top + plotH - s.value(p) / maxY * plotH;
+                    if (i === 0) ctx.moveTo(x, y); else ctx.lineTo(x, y);
+                });
+                ctx.stroke();
+            });
+        }
+
+        function renderCharts(container, samples, changes) {
+            if (!container.querySelector('canvas')) {
+                container.innerHTML = chartDefs.map(function (def) {
+                    return '<div class="chart-box">' +
+                        '<div class="chart-title">' + def.title + '</div>' +
+                        '<canvas class="chart" data-chart="' + def.key + '"></canvas>' +
+                        '<div class="chart-legend">' + def.series.map(function (s) {
+                            return '<span><i style="background: ' + s.color + '"></i>' + s.label + '</span>';
+                        }).join('') + '</div>' +
+                        '</div>';
+                }).join('');
+            }
+            chartDefs.forEach(function (def) {
+                drawChart(container.querySelector('canvas[data-chart="' + def.key + '"]'), samples, def, changes);
+            });
+        }
+`
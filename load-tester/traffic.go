@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"time"
+)
+
+// maxTrackedBodies caps how many distinct response bodies an endpoint
+// remembers when bodies are hashed.
+const maxTrackedBodies = 10000
+
+const bytesPerMB = 1e6
+
+// TrafficStats counts the payload bytes of a run. Bytes sent and received
+// are request and response bodies as the application sees them; wire bytes
+// are what actually went over the connections, with headers, TLS and
+// compression.
+type TrafficStats struct {
+	BytesSent        int64   `json:"bytes_sent"`
+	BytesReceived    int64   `json:"bytes_received"`
+	WireBytesSent    int64   `json:"wire_bytes_sent,omitempty"`
+	WireBytesRecv    int64   `json:"wire_bytes_received,omitempty"`
+	SentMBps         float64 `json:"sent_mb_per_sec"`
+	ReceivedMBps     float64 `json:"received_mb_per_sec"`
+	AvgRequestBytes  float64 `json:"avg_request_bytes"`
+	AvgResponseBytes float64 `json:"avg_response_bytes"`
+}
+
+// newTrafficStats fills in the rates and averages of requests that sent and
+// received the given body bytes over elapsedSec.
+func newTrafficStats(requests, sent, received int64, elapsedSec float64) TrafficStats {
+	s := TrafficStats{BytesSent: sent, BytesReceived: received}
+	if requests > 0 {
+		s.AvgRequestBytes = float64(sent) / float64(requests)
+		s.AvgResponseBytes = float64(received) / float64(requests)
+	}
+	if elapsedSec > 0 {
+		s.SentMBps = float64(sent) / bytesPerMB / elapsedSec
+		s.ReceivedMBps = float64(received) / bytesPerMB / elapsedSec
+	}
+	return s
+}
+
+// trafficStatsLocked returns the traffic of the current or last run.
+// lt.mutex must be held.
+func (lt *LoadTester) trafficStatsLocked(elapsedSec float64) TrafficStats {
+	s := newTrafficStats(lt.state.TotalReqs, lt.bytesSent, lt.bytesReceived, elapsedSec)
+	if lt.client != nil {
+		s.WireBytesSent, s.WireBytesRecv = lt.client.wireBytes()
+	}
+	return s
+}
+
+// elapsedLocked is how long the current run has been going, or how long the
+// last one went. lt.mutex must be held.
+func (lt *LoadTester) elapsedLocked() float64 {
+	if lt.state.Running {
+		return time.Since(lt.state.StartTime).Seconds()
+	}
+	if lt.state.Summary != nil {
+		return lt.state.Summary.DurationSec
+	}
+	return 0
+}
+
+func newBodyHash(enabled bool) hash.Hash {
+	if !enabled {
+		return nil
+	}
+	return sha256.New()
+}
+
+func hashString(h hash.Hash) string {
+	if h == nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
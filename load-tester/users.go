@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxUsers = 10000
+
+	thinkFixed       = "fixed"
+	thinkUniform     = "uniform"
+	thinkExponential = "exponential"
+)
+
+// UsersConfig switches a run to the closed model: Count virtual users, each
+// sending a request, waiting for its response and thinking before the next
+// one. The load profile ramps the number of users instead of the RPS.
+type UsersConfig struct {
+	Count     int       `json:"count"`
+	ThinkTime ThinkTime `json:"think_time"`
+}
+
+type ThinkTime struct {
+	Distribution string  `json:"distribution"`
+	MeanMs       float64 `json:"mean_ms,omitempty"`
+	MinMs        float64 `json:"min_ms,omitempty"`
+	MaxMs        float64 `json:"max_ms,omitempty"`
+}
+
+// UsersPoint is the throughput and latency a run reached while it had Users
+// virtual users, averaged over the seconds it spent at that count.
+type UsersPoint struct {
+	Users       int     `json:"users"`
+	Seconds     int     `json:"seconds"`
+	AchievedRPS float64 `json:"achieved_rps"`
+	P50         float64 `json:"p50_ms"`
+	P95         float64 `json:"p95_ms"`
+}
+
+func (cfg *UsersConfig) validate() error {
+	if cfg.Count <= 0 || cfg.Count > maxUsers {
+		return fmt.Errorf("users count must be between 1 and %d", maxUsers)
+	}
+	return cfg.ThinkTime.validate()
+}
+
+func (t *ThinkTime) validate() error {
+	if t.Distribution == "" {
+		t.Distribution = thinkFixed
+	}
+	if t.MeanMs < 0 || t.MinMs < 0 || t.MaxMs < 0 {
+		return fmt.Errorf("think time must not be negative")
+	}
+
+	switch t.Distribution {
+	case thinkFixed, thinkExponential:
+	case thinkUniform:
+		if t.MaxMs < t.MinMs {
+			return fmt.Errorf("think time max_ms must not be less than min_ms")
+		}
+	default:
+		return fmt.Errorf("unknown think time distribution %q", t.Distribution)
+	}
+	return nil
+}
+
+func (t ThinkTime) sample() time.Duration {
+	ms := t.MeanMs
+	switch t.Distribution {
+	case thinkUniform:
+		ms = t.MinMs + rand.Float64()*(t.MaxMs-t.MinMs)
+	case thinkExponential:
+		ms = rand.ExpFloat64() * t.MeanMs
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+func (t ThinkTime) String() string {
+	switch t.Distribution {
+	case thinkUniform:
+		return fmt.Sprintf("uniform %g-%gms", t.MinMs, t.MaxMs)
+	case thinkExponential:
+		return fmt.Sprintf("exponential, mean %gms", t.MeanMs)
+	default:
+		return fmt.Sprintf("%gms", t.MeanMs)
+	}
+}
+
+// parseThinkTime reads think time given as "2s", "exponential:1s" or
+// "uniform:500ms-2s".
+func parseThinkTime(s string) (ThinkTime, error) {
+	var t ThinkTime
+	dist, value, ok := strings.Cut(s, ":")
+	if !ok {
+		dist, value = thinkFixed, s
+	}
+	t.Distribution = dist
+
+	ms := func(v string) (float64, error) {
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return 0, err
+		}
+		return float64(d) / float64(time.Millisecond), nil
+	}
+
+	var err error
+	if dist == thinkUniform {
+		lo, hi, ok := strings.Cut(value, "-")
+		if !ok {
+			return t, fmt.Errorf("uniform think time must be min-max, e.g. uniform:500ms-2s")
+		}
+		if t.MinMs, err = ms(lo); err != nil {
+			return t, err
+		}
+		if t.MaxMs, err = ms(hi); err != nil {
+			return t, err
+		}
+	} else if t.MeanMs, err = ms(value); err != nil {
+		return t, err
+	}
+	return t, t.validate()
+}
+
+// runUsers drives a closed-model run: it keeps as many virtual users running
+// as the load profile asks for, re-evaluating the profile every second.
+func (lt *LoadTester) runUsers(cfg UsersConfig) {
+	defer atomic.StoreInt32(&lt.isRunning, 0)
+	ctx := lt.ctx
+
+	lt.mutex.RLock()
+	targetURL := lt.config.Target
+	maxRequests := lt.state.MaxRequests
+	deadline, stopDeadline := runDeadline(lt.state.StartTime, lt.state.DurationSec)
+	lt.mutex.RUnlock()
+	defer stopDeadline()
+
+	usersCtx, stopUsers := context.WithCancel(ctx)
+	defer stopUsers()
+
+	var sent int64
+	go lt.trackAchievedRPS(ctx, &sent, false)
+
+	done := make(chan string, 1)
+	var retire []chan struct{}
+	setUsers := func(target int) {
+		for len(retire) < target {
+			ch := make(chan struct{})
+			retire = append(retire, ch)
+			lt.wg.Add(1)
+			go lt.runUser(usersCtx, ch, targetURL, cfg.ThinkTime, &sent, maxRequests, done)
+		}
+		for len(retire) > target {
+			close(retire[len(retire)-1])
+			retire = retire[:len(retire)-1]
+		}
+
+		lt.mutex.Lock()
+		lt.state.Users = target
+		lt.mutex.Unlock()
+	}
+
+	// Before the first tick the profile has no elapsed time yet, and some
+	// profiles start from zero, so begin with at least one user.
+	setUsers(max(lt.profileTarget(), 1))
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-lt.stopChan:
+			return
+		case <-deadline:
+			stopUsers()
+			lt.finish(ctx, stopReasonDuration)
+			return
+		case reason := <-done:
+			stopUsers()
+			lt.finish(ctx, reason)
+			return
+		case <-ticker.C:
+		case <-lt.adjusted:
+		}
+		if target := lt.profileTarget(); target > 0 && target != len(retire) {
+			setUsers(target)
+		}
+	}
+}
+
+// runUser is one virtual user: request, wait for the response, think, repeat,
+// until the run ends or the user is retired by closing retire.
+func (lt *LoadTester) runUser(ctx context.Context, retire <-chan struct{}, targetURL string, think ThinkTime,
+	sent *int64, maxRequests int64, done chan<- string) {
+	defer lt.wg.Done()
+
+	signal := func(reason string) {
+		select {
+		case done <- reason:
+		default:
+		}
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-retire:
+			return
+		default:
+		}
+		if atomic.LoadInt32(&lt.isRunning) == 0 {
+			return
+		}
+
+		lt.mutex.RLock()
+		source := lt.source
+		lt.mutex.RUnlock()
+
+		ep, build, ok := source.next()
+		if !ok {
+			log.Println("📼 Request source exhausted")
+			signal(stopReasonExhausted)
+			return
+		}
+
+		n := atomic.AddInt64(sent, 1)
+		if maxRequests > 0 && n > maxRequests {
+			return
+		}
+		atomic.AddInt64(&lt.scheduled, 1)
+		atomic.AddInt64(&lt.sent, 1)
+		// A closed model has no schedule to fall behind: a virtual user
+		// sends its next request only when the previous one is done.
+		lt.execute(targetURL, ep, build, time.Time{})
+		if maxRequests > 0 && n == maxRequests {
+			signal(stopReasonMaxRequests)
+			return
+		}
+
+		if d := think.sample(); d > 0 {
+			timer.Reset(d)
+			select {
+			case <-ctx.Done():
+				return
+			case <-retire:
+				return
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// usersCurve groups the timeline of a closed-model run by user count, giving
+// the concurrency-vs-throughput curve of the target.
+func usersCurve(timeline []TimelineSample) []UsersPoint {
+	byUsers := make(map[int]*UsersPoint)
+	for _, sample := range timeline {
+		if sample.Users == 0 {
+			continue
+		}
+		p, ok := byUsers[sample.Users]
+		if !ok {
+			p = &UsersPoint{Users: sample.Users}
+			byUsers[sample.Users] = p
+		}
+		p.Seconds++
+		p.AchievedRPS += float64(sample.AchievedRPS)
+		p.P50 += sample.P50
+		p.P95 += sample.P95
+	}
+
+	curve := make([]UsersPoint, 0, len(byUsers))
+	for _, p := range byUsers {
+		n := float64(p.Seconds)
+		p.AchievedRPS, p.P50, p.P95 = p.AchievedRPS/n, p.P50/n, p.P95/n
+		curve = append(curve, *p)
+	}
+	sort.Slice(curve, func(i, j int) bool { return curve[i].Users < curve[j].Users })
+	return curve
+}